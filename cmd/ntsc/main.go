@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"ntsc-wasm/pkg/artifact"
+	"ntsc-wasm/pkg/interop"
+	"ntsc-wasm/pkg/ntsc"
+	"ntsc-wasm/pkg/preset"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type setFlags []string
+
+func (s *setFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *setFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected Field=value, got %q", value)
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+type pathFlags []string
+
+func (p *pathFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathFlags) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+type options struct {
+	input       string
+	output      string
+	configPath  string
+	presetName  string
+	presetPaths pathFlags
+	importPath  string
+	token       string
+	fromImage   string
+	readRecipe  string
+	recipe      bool
+	printToken  bool
+	exportTo    string
+	pipeline    string
+	sets        setFlags
+	seed        uint64
+	hasSeed     bool
+	maxWidth    int
+	maxHeight   int
+	outWidth    int
+	outHeight   int
+	jpegQuality int
+	listPresets bool
+	listStages  bool
+	listParams  bool
+	printConfig bool
+	printSchema bool
+	timings     bool
+	maxPixels   int64
+	maxMemory   int64
+	timeout     time.Duration
+	cpuProfile  string
+	memProfile  string
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.configPath, "config", "", "path to a partial NtscConfig JSON file, applied on top of -preset or the preset named by its \"base\" key")
+	flag.StringVar(&opts.presetName, "preset", "", "name of a built-in preset to start from")
+	flag.StringVar(&opts.importPath, "import", "", "start from an ntscQT or ntsc-rs preset file instead of -preset")
+	flag.StringVar(&opts.token, "token", "", "start from a config token printed by -print-token instead of -preset")
+	flag.StringVar(&opts.fromImage, "from-image", "", "start from the recipe embedded in an image written with -recipe")
+	flag.StringVar(&opts.exportTo, "export", "", "print the resolved config as an ntscqt or ntsc-rs preset and exit")
+	flag.Var(&opts.presetPaths, "presets", "load user presets from a JSON file or a directory of them (repeatable)")
+	flag.StringVar(&opts.pipeline, "pipeline", "", "comma-separated stage names to run instead of the default pipeline")
+	flag.Var(&opts.sets, "set", "override a config field, e.g. -set VideoNoise=20 (repeatable)")
+	flag.Uint64Var(&opts.seed, "seed", 0, "override RandomSeed")
+	flag.IntVar(&opts.maxWidth, "max-width", 0, "downscale the input to at most this width")
+	flag.IntVar(&opts.maxHeight, "max-height", 0, "downscale the input to at most this height")
+	flag.IntVar(&opts.outWidth, "output-width", 0, "scale the output to this width, keeping the aspect ratio unless -output-height is also set")
+	flag.IntVar(&opts.outHeight, "output-height", 0, "scale the output to this height, keeping the aspect ratio unless -output-width is also set")
+	flag.Int64Var(&opts.maxPixels, "max-pixels", artifact.DefaultLimits.MaxPixels, "refuse inputs with more pixels than this, checked before decoding (0 for no limit)")
+	flag.Int64Var(&opts.maxMemory, "max-memory", artifact.DefaultLimits.MaxMemory>>20, "refuse inputs needing more working memory than this many MiB (0 for no limit)")
+	flag.DurationVar(&opts.timeout, "timeout", 0, "stop processing after this long, e.g. 30s (0 for no limit)")
+	flag.IntVar(&opts.jpegQuality, "quality", 95, "JPEG output quality")
+	flag.BoolVar(&opts.listPresets, "list-presets", false, "list built-in presets and exit")
+	flag.BoolVar(&opts.listStages, "list-stages", false, "print the default pipeline and exit")
+	flag.BoolVar(&opts.listParams, "list-params", false, "list the config fields with their ranges and exit")
+	flag.BoolVar(&opts.printConfig, "print-config", false, "print the resolved config as JSON and exit")
+	flag.BoolVar(&opts.printToken, "print-token", false, "print the resolved config as a shareable token and exit")
+	flag.BoolVar(&opts.recipe, "recipe", false, "embed the config, seed, preset and tool version in the output's metadata")
+	flag.StringVar(&opts.readRecipe, "read-recipe", "", "print the recipe embedded in an image and exit")
+	flag.BoolVar(&opts.timings, "timings", false, "print per-stage timings to stderr")
+	flag.BoolVar(&opts.printSchema, "print-schema", false, "print the JSON Schema of config files and exit")
+	flag.StringVar(&opts.cpuProfile, "cpuprofile", "", "write a CPU profile to this file")
+	flag.StringVar(&opts.memProfile, "memprofile", "", "write a heap profile to this file on exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] input.(png|jpg) output.(png|jpg)\n\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	// -seed 0 is a seed like any other, so look for the flag itself
+	flag.Visit(func(f *flag.Flag) {
+		opts.hasSeed = opts.hasSeed || f.Name == "seed"
+	})
+
+	err := profile(&opts, func() error { return run(&opts, flag.Args()) })
+	if err != nil {
+		// Errors from the ntsc package already carry the prefix
+		fmt.Fprintf(os.Stderr, "ntsc: %s\n", strings.TrimPrefix(err.Error(), "ntsc: "))
+		os.Exit(1)
+	}
+}
+
+// profile calls fn while recording the profiles requested by opts. Read them
+// with go tool pprof.
+func profile(opts *options, fn func() error) error {
+	if opts.cpuProfile != "" {
+		f, err := os.Create(opts.cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return fmt.Errorf("failed to start CPU profile: %v", err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	if opts.memProfile != "" {
+		f, err := os.Create(opts.memProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// Collect garbage so the profile shows live memory as of now
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			return fmt.Errorf("failed to write heap profile: %v", err)
+		}
+	}
+	return nil
+}
+
+func run(opts *options, args []string) error {
+	if opts.listStages {
+		fmt.Println(strings.Join(ntsc.DefaultPipelineStages, ","))
+		return nil
+	}
+
+	for _, path := range opts.presetPaths {
+		if err := loadPresets(path); err != nil {
+			return err
+		}
+	}
+
+	if opts.listPresets {
+		return listPresets(os.Stdout)
+	}
+
+	if opts.listParams {
+		return listParams(os.Stdout)
+	}
+
+	if opts.printSchema {
+		schema, err := ntsc.ConfigSchema()
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(schema))
+		return nil
+	}
+
+	if opts.readRecipe != "" {
+		recipe, err := readRecipe(opts.readRecipe)
+		if err != nil {
+			return err
+		}
+		recipeJSON, err := json.MarshalIndent(recipe, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal recipe: %v", err)
+		}
+		fmt.Println(string(recipeJSON))
+		return nil
+	}
+
+	config, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.printConfig {
+		configJSON, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %v", err)
+		}
+		fmt.Println(string(configJSON))
+		return nil
+	}
+
+	if opts.printToken {
+		fmt.Println(ntsc.EncodeToken(config))
+		return nil
+	}
+
+	if opts.exportTo != "" {
+		format, err := interop.ParseFormat(opts.exportTo)
+		if err != nil {
+			return err
+		}
+		data, warnings, err := interop.Export(format, config)
+		if err != nil {
+			return err
+		}
+		printWarnings(warnings)
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(args) != 2 {
+		flag.Usage()
+		return fmt.Errorf("expected an input and an output path")
+	}
+	opts.input, opts.output = args[0], args[1]
+
+	var pipeline ntsc.Pipeline
+	if opts.pipeline != "" {
+		if pipeline, err = ntsc.NewPipeline(strings.Split(opts.pipeline, ",")...); err != nil {
+			return err
+		}
+	}
+
+	format := artifact.FormatPNG
+	if ext := filepath.Ext(opts.output); ext != "" {
+		if format, err = artifact.ParseFormat(ext); err != nil {
+			return err
+		}
+	}
+
+	limits := artifact.Limits{
+		MaxPixels:   opts.maxPixels,
+		MaxMemory:   opts.maxMemory << 20,
+		MaxDuration: opts.timeout,
+	}
+	img, err := readImage(opts.input, limits, opts.maxWidth, opts.maxHeight)
+	if err != nil {
+		return err
+	}
+
+	processOpts := []artifact.Option{
+		artifact.WithConfig(config),
+		artifact.WithPipeline(pipeline),
+		artifact.WithMaxSize(opts.maxWidth, opts.maxHeight),
+		artifact.WithOutputSize(opts.outWidth, opts.outHeight),
+		artifact.WithLimits(limits),
+	}
+	var report *ntsc.TimingReport
+	if opts.timings {
+		report = ntsc.NewTimingReport()
+		processOpts = append(processOpts, artifact.WithObserver(report))
+	}
+
+	result, err := artifact.Process(img, processOpts...)
+	if err != nil {
+		return err
+	}
+	if report != nil {
+		fmt.Fprint(os.Stderr, report)
+	}
+
+	var recipe *artifact.Recipe
+	if opts.recipe {
+		recipe = artifact.NewRecipe(config, opts.presetName, pipeline)
+	}
+	return writeImage(opts.output, result, format, opts.jpegQuality, recipe)
+}
+
+func loadConfig(opts *options) (*ntsc.NtscConfig, error) {
+	config := ntsc.DefaultNtscConfig()
+	starts := 0
+	for _, start := range []string{opts.presetName, opts.importPath, opts.token, opts.fromImage} {
+		if start != "" {
+			starts++
+		}
+	}
+	if starts > 1 {
+		return nil, fmt.Errorf("only one of -preset, -import, -token and -from-image can be used")
+	}
+	if opts.presetName != "" {
+		var err error
+		if config, err = preset.Get(opts.presetName); err != nil {
+			return nil, err
+		}
+	}
+	if opts.importPath != "" {
+		var err error
+		if config, err = importPreset(opts.importPath); err != nil {
+			return nil, err
+		}
+	}
+	if opts.token != "" {
+		var err error
+		if config, err = ntsc.DecodeToken(opts.token); err != nil {
+			return nil, err
+		}
+	}
+	if opts.fromImage != "" {
+		recipe, err := readRecipe(opts.fromImage)
+		if err != nil {
+			return nil, err
+		}
+		config = recipe.Config
+		if opts.pipeline == "" {
+			opts.pipeline = strings.Join(recipe.Pipeline, ",")
+		}
+		if opts.presetName == "" {
+			opts.presetName = recipe.Preset
+		}
+	}
+
+	if opts.configPath != "" {
+		data, err := os.ReadFile(opts.configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %v", err)
+		}
+		if config, err = preset.DecodeOnto(config, data); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %v", opts.configPath, err)
+		}
+	}
+
+	for _, set := range opts.sets {
+		field, value, _ := strings.Cut(set, "=")
+		if err := setField(config, field, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.seed > math.MaxUint32 {
+		return nil, fmt.Errorf("seed %d does not fit in 32 bits", opts.seed)
+	}
+	if opts.hasSeed {
+		config.RandomSeed = uint32(opts.seed)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// setField overlays a single Field=value pair onto config, reusing the JSON
+// decoder so that values are parsed exactly like they are in config files.
+func setField(config *ntsc.NtscConfig, field, value string) error {
+	field = strings.TrimSpace(field)
+	value = strings.TrimSpace(value)
+
+	// NtscConfig decodes through its own UnmarshalJSON, which does not see
+	// the decoder's DisallowUnknownFields, so names are checked here
+	if _, ok := ntsc.LookupParam(field); !ok {
+		return fmt.Errorf("invalid -set %s=%s: unknown field %q", field, value, field)
+	}
+
+	raw := json.RawMessage(value)
+	if !json.Valid(raw) {
+		quoted, _ := json.Marshal(value)
+		raw = quoted
+	}
+
+	overlay, err := json.Marshal(map[string]json.RawMessage{field: raw})
+	if err != nil {
+		return fmt.Errorf("invalid -set %s=%s: %v", field, value, err)
+	}
+
+	if err := json.Unmarshal(overlay, config); err != nil {
+		return fmt.Errorf("invalid -set %s=%s: %v", field, value, err)
+	}
+	return nil
+}
+
+// importPreset reads an ntscQT or ntsc-rs preset, reporting the parameters
+// that did not convert exactly on stderr.
+func importPreset(path string) (*ntsc.NtscConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preset: %v", err)
+	}
+	format, err := interop.DetectFormat(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import %s: %v", path, err)
+	}
+	config, warnings, err := interop.Import(format, data)
+	printWarnings(warnings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import %s: %v", path, err)
+	}
+	return config, nil
+}
+
+func printWarnings(warnings []interop.Warning) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+}
+
+func loadPresets(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to load presets: %v", err)
+	}
+	if info.IsDir() {
+		return preset.LoadDir(path)
+	}
+	return preset.LoadFile(path)
+}
+
+func listPresets(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tEXTENDS\tTAGS\tDESCRIPTION")
+	for _, p := range preset.ListPresets() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Name, p.Extends, strings.Join(p.Tags, ","), p.Description)
+	}
+	return tw.Flush()
+}
+
+func listParams(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tGROUP\tTYPE\tDEFAULT\tRANGE\tDESCRIPTION")
+	for _, p := range ntsc.Params() {
+		var valid string
+		switch {
+		case p.Options != nil:
+			options := make([]string, len(p.Options))
+			for i, o := range p.Options {
+				options[i] = fmt.Sprint(o)
+			}
+			valid = strings.Join(options, "|")
+		case p.Min != nil && p.Max != nil:
+			valid = fmt.Sprintf("%g..%g", *p.Min, *p.Max)
+		}
+		if p.Unit != "" {
+			valid += " " + p.Unit
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%s\t%s\n", p.Name, p.Group, p.Type, p.Default, valid, p.Description)
+	}
+	return tw.Flush()
+}
+
+// readImage decodes the image at path once its header passes limits.
+func readImage(path string, limits artifact.Limits, maxWidth, maxHeight int) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %v", err)
+	}
+	if _, _, err := limits.CheckHeader(data, maxWidth, maxHeight); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image %s: %v", path, err)
+	}
+	return img, nil
+}
+
+// writeImage encodes img to path, embedding recipe if it is not nil.
+func writeImage(path string, img image.Image, format artifact.Format, jpegQuality int, recipe *artifact.Recipe) error {
+	var buf bytes.Buffer
+	if err := artifact.Encode(&buf, img, format, jpegQuality); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if recipe != nil {
+		var err error
+		if data, err = artifact.EmbedRecipe(data, format, recipe); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	return nil
+}
+
+func readRecipe(path string) (*artifact.Recipe, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %v", err)
+	}
+	recipe, err := artifact.ReadRecipe(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return recipe, nil
+}
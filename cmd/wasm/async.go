@@ -0,0 +1,110 @@
+//go:build wasm
+
+package main
+
+import (
+	"context"
+	"ntsc-wasm/pkg/ntsc"
+	"strconv"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// yieldInterval is how long processing may run before handing control back
+// to the JavaScript event loop, so that cancelRequest calls get delivered.
+const yieldInterval = 50 * time.Millisecond
+
+var (
+	requestsMu sync.Mutex
+	requests   = map[string]context.CancelFunc{}
+)
+
+// processNTSCAsync(requestJSON, requestId, onProgress) returns a Promise that
+// resolves to the same object as processNTSC. The request can be stopped with
+// cancelRequest(requestId); onProgress(stage, done) is optional.
+func processNTSCAsync(this js.Value, args []js.Value) interface{} {
+	return startRequest(args, runProcessNTSC)
+}
+
+// processVideoFrameAsync is the cancellable counterpart of processVideoFrame.
+func processVideoFrameAsync(this js.Value, args []js.Value) interface{} {
+	return startRequest(args, runProcessVideoFrame)
+}
+
+func cancelRequest(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return map[string]interface{}{
+			"error": "Invalid number of arguments",
+		}
+	}
+
+	requestsMu.Lock()
+	cancel, ok := requests[requestKey(args[0])]
+	requestsMu.Unlock()
+	if ok {
+		cancel()
+	}
+	return map[string]interface{}{
+		"canceled": ok,
+	}
+}
+
+func startRequest(args []js.Value, run func(context.Context, string, ntsc.ProgressFunc) map[string]interface{}) interface{} {
+	if len(args) < 2 {
+		return map[string]interface{}{
+			"error": "Invalid number of arguments",
+		}
+	}
+
+	reqJSON := args[0].String()
+	key := requestKey(args[1])
+	var onProgress js.Value
+	if len(args) > 2 && args[2].Type() == js.TypeFunction {
+		onProgress = args[2]
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	requestsMu.Lock()
+	requests[key] = cancel
+	requestsMu.Unlock()
+
+	executor := js.FuncOf(func(this js.Value, promiseArgs []js.Value) interface{} {
+		resolve := promiseArgs[0]
+		go func() {
+			defer func() {
+				requestsMu.Lock()
+				delete(requests, key)
+				requestsMu.Unlock()
+				cancel()
+			}()
+			resolve.Invoke(run(ctx, reqJSON, yieldingProgress(onProgress)))
+		}()
+		return nil
+	})
+	defer executor.Release()
+
+	return js.Global().Get("Promise").New(executor)
+}
+
+// yieldingProgress forwards progress to onProgress and periodically sleeps so
+// the Go scheduler returns to the event loop while a request is running.
+func yieldingProgress(onProgress js.Value) ntsc.ProgressFunc {
+	lastYield := time.Now()
+	return func(stage string, done float64) {
+		if onProgress.Type() == js.TypeFunction {
+			onProgress.Invoke(stage, done)
+		}
+		if time.Since(lastYield) > yieldInterval {
+			time.Sleep(time.Millisecond)
+			lastYield = time.Now()
+		}
+	}
+}
+
+func requestKey(v js.Value) string {
+	if v.Type() == js.TypeNumber {
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+	return v.String()
+}
@@ -4,14 +4,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
+	"ntsc-wasm/pkg/artifact"
 	ntscImage "ntsc-wasm/pkg/image"
+	"ntsc-wasm/pkg/interop"
 	"ntsc-wasm/pkg/ntsc"
+	"ntsc-wasm/pkg/preset"
 	"strings"
 	"syscall/js"
 	"time"
@@ -19,21 +24,38 @@ import (
 
 var debugMode = false
 
+// limits applies to every request; see setLimits.
+var limits = artifact.DefaultLimits
+
+// LimitsRequest is the argument of setLimits. Zero fields are unlimited.
+type LimitsRequest struct {
+	MaxPixels   int64 `json:"maxPixels"`
+	MaxMemoryMB int64 `json:"maxMemoryMB"`
+	TimeoutMs   int64 `json:"timeoutMs"`
+}
+
+// Config may be partial; omitted fields keep the values of DefaultNtscConfig
+// or of the preset named by its "base" key, see preset.Decode.
 type ProcessRequest struct {
-	ImageData string           `json:"imageData"`
-	Config    *ntsc.NtscConfig `json:"config"`
-	MaxWidth  int              `json:"maxWidth,omitempty"`
-	MaxHeight int              `json:"maxHeight,omitempty"`
+	ImageData string          `json:"imageData"`
+	Config    json.RawMessage `json:"config"`
+	MaxWidth  int             `json:"maxWidth,omitempty"`
+	MaxHeight int             `json:"maxHeight,omitempty"`
+	// Report adds per-stage timings to the result
+	Report bool `json:"report,omitempty"`
+	// Recipe embeds the config, seed and preset in the output PNG
+	Recipe bool `json:"recipe,omitempty"`
 }
 
 type VideoProcessRequest struct {
-	ImageData   string           `json:"imageData"`
-	Config      *ntsc.NtscConfig `json:"config"`
-	MaxWidth    int              `json:"maxWidth,omitempty"`
-	MaxHeight   int              `json:"maxHeight,omitempty"`
-	FrameNumber int              `json:"frameNumber"`
-	TotalFrames int              `json:"totalFrames,omitempty"`
-	Timestamp   float64          `json:"timestamp,omitempty"`
+	ImageData   string          `json:"imageData"`
+	Config      json.RawMessage `json:"config"`
+	MaxWidth    int             `json:"maxWidth,omitempty"`
+	MaxHeight   int             `json:"maxHeight,omitempty"`
+	FrameNumber int             `json:"frameNumber"`
+	TotalFrames int             `json:"totalFrames,omitempty"`
+	Timestamp   float64         `json:"timestamp,omitempty"`
+	Report      bool            `json:"report,omitempty"`
 }
 
 type ProcessResponse struct {
@@ -46,7 +68,20 @@ func main() {
 
 	js.Global().Set("processNTSC", js.FuncOf(processNTSC))
 	js.Global().Set("processVideoFrame", js.FuncOf(processVideoFrame))
+	js.Global().Set("processNTSCAsync", js.FuncOf(processNTSCAsync))
+	js.Global().Set("processVideoFrameAsync", js.FuncOf(processVideoFrameAsync))
+	js.Global().Set("cancelRequest", js.FuncOf(cancelRequest))
 	js.Global().Set("getPreset", js.FuncOf(getPreset))
+	js.Global().Set("listPresets", js.FuncOf(listPresets))
+	js.Global().Set("registerPreset", js.FuncOf(registerPreset))
+	js.Global().Set("importPreset", js.FuncOf(importPreset))
+	js.Global().Set("exportPreset", js.FuncOf(exportPreset))
+	js.Global().Set("encodeToken", js.FuncOf(encodeToken))
+	js.Global().Set("decodeToken", js.FuncOf(decodeToken))
+	js.Global().Set("readRecipe", js.FuncOf(readRecipe))
+	js.Global().Set("describeConfig", js.FuncOf(describeConfig))
+	js.Global().Set("setLimits", js.FuncOf(setLimits))
+	js.Global().Set("getLimits", js.FuncOf(getLimits))
 	js.Global().Set("setDebugMode", js.FuncOf(setDebugMode))
 	js.Global().Set("getDebugMode", js.FuncOf(getDebugMode))
 
@@ -55,15 +90,26 @@ func main() {
 }
 
 func processNTSC(this js.Value, args []js.Value) interface{} {
-	startTotal := time.Now()
+	if len(args) != 1 {
+		return map[string]interface{}{
+			"error": "Invalid number of arguments",
+		}
+	}
+	return runProcessNTSC(context.Background(), args[0].String(), nil)
+}
 
+func processVideoFrame(this js.Value, args []js.Value) interface{} {
 	if len(args) != 1 {
 		return map[string]interface{}{
 			"error": "Invalid number of arguments",
 		}
 	}
+	return runProcessVideoFrame(context.Background(), args[0].String(), nil)
+}
+
+func runProcessNTSC(ctx context.Context, reqJSON string, progress ntsc.ProgressFunc) map[string]interface{} {
+	startTotal := time.Now()
 
-	reqJSON := args[0].String()
 	var req ProcessRequest
 	if err := json.Unmarshal([]byte(reqJSON), &req); err != nil {
 		return map[string]interface{}{
@@ -71,274 +117,504 @@ func processNTSC(this js.Value, args []js.Value) interface{} {
 		}
 	}
 
-	if req.Config == nil {
-		req.Config = ntsc.DefaultNtscConfig()
+	config, err := preset.Decode(req.Config)
+	if err != nil {
+		return errorResult(err)
+	}
+	if err := config.Validate(); err != nil {
+		return errorResult(err)
 	}
 
-	// Decode image data
-	start := time.Now()
-	imageData, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.ImageData, "data:image/png;base64,"))
+	var recipe *artifact.Recipe
+	if req.Recipe {
+		recipe = artifact.NewRecipe(config, preset.BaseName(req.Config), nil)
+	}
+
+	report := newReport(req.Report)
+	resultData, err := renderImage(ctx, req.ImageData, config, 0, req.MaxWidth, req.MaxHeight, progress, report, recipe)
 	if err != nil {
-		imageData, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(req.ImageData, "data:image/jpeg;base64,"))
-		if err != nil {
-			return map[string]interface{}{
-				"error": fmt.Sprintf("Failed to decode image data: %v", err),
-			}
+		return errorResult(err)
+	}
+
+	result := map[string]interface{}{
+		"imageData": resultData,
+	}
+	addReport(result, report, req.Report, time.Since(startTotal))
+	return result
+}
+
+func runProcessVideoFrame(ctx context.Context, reqJSON string, progress ntsc.ProgressFunc) map[string]interface{} {
+	startTotal := time.Now()
+
+	var req VideoProcessRequest
+	if err := json.Unmarshal([]byte(reqJSON), &req); err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to parse request: %v", err),
 		}
 	}
-	if debugMode {
-		fmt.Printf("DEBUG: Base64 decode took %v\n", time.Since(start))
+
+	config, err := preset.Decode(req.Config)
+	if err != nil {
+		return errorResult(err)
+	}
+	if err := config.Validate(); err != nil {
+		return errorResult(err)
 	}
 
-	// Decode image
-	start = time.Now()
-	var img image.Image
-	if strings.Contains(req.ImageData, "data:image/png") {
-		img, err = png.Decode(bytes.NewReader(imageData))
-	} else {
-		img, err = jpeg.Decode(bytes.NewReader(imageData))
+	// Update random seeds based on frame number for consistent video effects
+	if req.FrameNumber > 0 {
+		config.RandomSeed = config.RandomSeed + uint32(req.FrameNumber)
+		config.RandomSeed2 = config.RandomSeed2 + uint32(req.FrameNumber*2)
 	}
+
+	report := newReport(req.Report)
+	resultData, err := renderImage(ctx, req.ImageData, config, req.FrameNumber, req.MaxWidth, req.MaxHeight, progress, report, nil)
 	if err != nil {
+		result := errorResult(err)
+		result["frameNumber"] = req.FrameNumber
+		return result
+	}
+
+	result := map[string]interface{}{
+		"imageData":   resultData,
+		"frameNumber": req.FrameNumber,
+	}
+	addReport(result, report, req.Report, time.Since(startTotal))
+	return result
+}
+
+// newReport returns a timing report if the request asked for one or debug
+// logging is on, and nil otherwise.
+func newReport(requested bool) *ntsc.TimingReport {
+	if requested || debugMode {
+		return ntsc.NewTimingReport()
+	}
+	return nil
+}
+
+// addReport logs report in debug mode and adds it to result if requested.
+func addReport(result map[string]interface{}, report *ntsc.TimingReport, requested bool, total time.Duration) {
+	if report == nil {
+		return
+	}
+	if debugMode {
+		fmt.Printf("DEBUG: request took %v\n%s", total, report)
+	}
+	if !requested {
+		return
+	}
+
+	timings := report.Timings()
+	stages := make([]interface{}, len(timings))
+	for i, t := range timings {
+		stages[i] = map[string]interface{}{
+			"stage":      t.Stage,
+			"field":      t.Field,
+			"calls":      t.Calls,
+			"rows":       t.Rows,
+			"ms":         float64(t.Duration) / float64(time.Millisecond),
+			"allocs":     t.Allocs,
+			"allocBytes": t.AllocBytes,
+		}
+	}
+	result["report"] = map[string]interface{}{
+		"stages":  stages,
+		"totalMs": float64(total) / float64(time.Millisecond),
+	}
+}
+
+func errorResult(err error) map[string]interface{} {
+	if errors.Is(err, context.Canceled) {
 		return map[string]interface{}{
-			"error": fmt.Sprintf("Failed to decode image: %v", err),
+			"error":    "Processing cancelled",
+			"canceled": true,
 		}
 	}
-	if debugMode {
-		fmt.Printf("DEBUG: Image decode took %v\n", time.Since(start))
+	result := map[string]interface{}{
+		"error": err.Error(),
 	}
+	if errors.Is(err, artifact.ErrLimitExceeded) {
+		result["limitExceeded"] = true
+	}
+	var invalid *ntsc.ValidationError
+	if errors.As(err, &invalid) {
+		fields := make([]interface{}, len(invalid.Fields))
+		for i, f := range invalid.Fields {
+			fields[i] = map[string]interface{}{
+				"field":   f.Field,
+				"value":   fmt.Sprint(f.Value),
+				"allowed": f.Allowed,
+			}
+		}
+		result["invalidFields"] = fields
+	}
+	return result
+}
 
-	// Convert to ntscImage
-	start = time.Now()
-	ntscImg := ntscImage.FromGoImage(img)
-	if debugMode {
-		fmt.Printf("DEBUG: FromGoImage took %v\n", time.Since(start))
+// renderImage decodes a data URL, processes it and returns the result as a
+// PNG data URL, with recipe embedded if it is not nil. Every step is reported
+// to report, which may be nil.
+func renderImage(ctx context.Context, dataURL string, config *ntsc.NtscConfig, frame, maxWidth, maxHeight int, progress ntsc.ProgressFunc, report *ntsc.TimingReport, recipe *artifact.Recipe) (string, error) {
+	var observer ntsc.Observer
+	if report != nil {
+		observer = report
+	}
+
+	// Decode image data
+	var imageData []byte
+	var err error
+	ntsc.Trace(observer, "base64Decode", -1, 0, func() {
+		imageData, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(dataURL, "data:image/png;base64,"))
+		if err != nil {
+			imageData, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(dataURL, "data:image/jpeg;base64,"))
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to decode image data: %v", err)
 	}
 
-	maxWidth := req.MaxWidth
-	maxHeight := req.MaxHeight
+	// Reject oversized images from their header, before decoding them
+	limits := limits
+	if _, _, err := limits.CheckHeader(imageData, maxWidth, maxHeight); err != nil {
+		return "", err
+	}
+
+	// Decode image
+	var img image.Image
+	ntsc.Trace(observer, "imageDecode", -1, 0, func() {
+		if strings.Contains(dataURL, "data:image/png") {
+			img, err = png.Decode(bytes.NewReader(imageData))
+		} else {
+			img, err = jpeg.Decode(bytes.NewReader(imageData))
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to decode image: %v", err)
+	}
+
+	// Convert to ntscImage
+	var ntscImg *ntscImage.Image
+	ntsc.Trace(observer, "fromGoImage", -1, img.Bounds().Dy(), func() {
+		ntscImg = ntscImage.FromGoImage(img)
+	})
 
 	// Resize image
 	if maxWidth > 0 || maxHeight > 0 {
-		start = time.Now()
-		ntscImg = ntscImg.Resize(maxWidth, maxHeight)
-		if debugMode {
-			fmt.Printf("DEBUG: Resize took %v\n", time.Since(start))
-		}
+		ntsc.Trace(observer, "resize", -1, ntscImg.Height, func() {
+			ntscImg = ntscImg.Resize(maxWidth, maxHeight)
+		})
 	}
 
-	processor := ntsc.NewNtscProcessor(req.Config)
+	processor, err := ntsc.NewNtscProcessor(config)
+	if err != nil {
+		return "", err
+	}
+	processor.Observer = observer
+	processor.Frame = frame
 
 	// Process image
-	start = time.Now()
-	processedImg := processor.ProcessImage(ntscImg)
-	if debugMode {
-		fmt.Printf("DEBUG: ProcessImage took %v\n", time.Since(start))
+	ctx, cancel := limits.WithTimeout(ctx)
+	defer cancel()
+	processedImg, err := processor.ProcessImageContext(ctx, ntscImg, progress)
+	if err != nil {
+		return "", limits.Err(ctx, err)
 	}
 
 	// Convert back to Go image
-	start = time.Now()
-	resultImg := processedImg.ToGoImage()
-	if debugMode {
-		fmt.Printf("DEBUG: ToGoImage took %v\n", time.Since(start))
-	}
+	var resultImg image.Image
+	ntsc.Trace(observer, "toGoImage", -1, processedImg.Height, func() {
+		resultImg = processedImg.ToGoImage()
+	})
+	ntsc.Release(processedImg)
 
 	// Encode result image
-	start = time.Now()
 	var buf bytes.Buffer
-	encoder := png.Encoder{CompressionLevel: png.NoCompression}
-	if err := encoder.Encode(&buf, resultImg); err != nil {
-		return map[string]interface{}{
-			"error": fmt.Sprintf("Failed to encode result image: %v", err),
-		}
+	ntsc.Trace(observer, "imageEncode", -1, 0, func() {
+		encoder := png.Encoder{CompressionLevel: png.NoCompression}
+		err = encoder.Encode(&buf, resultImg)
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode result image: %v", err)
 	}
-	if debugMode {
-		fmt.Printf("DEBUG: Image encode took %v\n", time.Since(start))
+	encoded := buf.Bytes()
+	if recipe != nil {
+		if encoded, err = artifact.EmbedRecipe(encoded, artifact.FormatPNG, recipe); err != nil {
+			return "", err
+		}
 	}
 
 	// Encode to base64
-	start = time.Now()
-	resultData := base64.StdEncoding.EncodeToString(buf.Bytes())
-	if debugMode {
-		fmt.Printf("DEBUG: Base64 encode took %v\n", time.Since(start))
+	var resultData string
+	ntsc.Trace(observer, "base64Encode", -1, 0, func() {
+		resultData = base64.StdEncoding.EncodeToString(encoded)
+	})
+	return "data:image/png;base64," + resultData, nil
+}
+
+func getPreset(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return map[string]interface{}{
+			"error": "Invalid number of arguments",
+		}
 	}
 
-	if debugMode {
-		fmt.Printf("DEBUG: Total processNTSC took %v\n", time.Since(startTotal))
+	config, err := preset.Get(args[0].String())
+	if err != nil {
+		return errorResult(err)
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to marshal config: %v", err),
+		}
 	}
+
 	return map[string]interface{}{
-		"imageData": "data:image/png;base64," + resultData,
+		"config": string(configJSON),
 	}
 }
 
-func processVideoFrame(this js.Value, args []js.Value) interface{} {
-	startTotal := time.Now()
+// listPresets returns the registered presets, without their configs, as a
+// JSON string.
+func listPresets(this js.Value, args []js.Value) interface{} {
+	presets := preset.ListPresets()
+	for i := range presets {
+		presets[i].Config = nil
+	}
+	presetsJSON, err := json.Marshal(presets)
+	if err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to marshal presets: %v", err),
+		}
+	}
+
+	return map[string]interface{}{
+		"presets": string(presetsJSON),
+	}
+}
 
+// registerPreset adds a user preset, given in the JSON format of preset
+// files, to the registry shared by every request.
+func registerPreset(this js.Value, args []js.Value) interface{} {
 	if len(args) != 1 {
 		return map[string]interface{}{
 			"error": "Invalid number of arguments",
 		}
 	}
 
-	reqJSON := args[0].String()
-	var req VideoProcessRequest
-	if err := json.Unmarshal([]byte(reqJSON), &req); err != nil {
+	var p preset.Preset
+	if err := json.Unmarshal([]byte(args[0].String()), &p); err != nil {
 		return map[string]interface{}{
-			"error": fmt.Sprintf("Failed to parse request: %v", err),
+			"error": fmt.Sprintf("Failed to parse preset: %v", err),
 		}
 	}
-
-	if req.Config == nil {
-		req.Config = ntsc.DefaultNtscConfig()
+	if err := preset.Register(p); err != nil {
+		return errorResult(err)
 	}
-
-	// Update random seeds based on frame number for consistent video effects
-	if req.FrameNumber > 0 {
-		req.Config.RandomSeed = req.Config.RandomSeed + uint32(req.FrameNumber)
-		req.Config.RandomSeed2 = req.Config.RandomSeed2 + uint32(req.FrameNumber*2)
+	return map[string]interface{}{
+		"name": p.Name,
 	}
+}
 
-	// Decode image data
-	start := time.Now()
-	imageData, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.ImageData, "data:image/png;base64,"))
-	if err != nil {
-		imageData, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(req.ImageData, "data:image/jpeg;base64,"))
-		if err != nil {
-			return map[string]interface{}{
-				"error": fmt.Sprintf("Failed to decode image data: %v", err),
-			}
+// importPreset converts an ntscQT or ntsc-rs preset into a config. The format
+// is detected unless given as the second argument.
+func importPreset(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 && len(args) != 2 {
+		return map[string]interface{}{
+			"error": "Invalid number of arguments",
 		}
 	}
-	if debugMode {
-		fmt.Printf("DEBUG: Base64 decode took %v\n", time.Since(start))
-	}
 
-	// Decode image
-	start = time.Now()
-	var img image.Image
-	if strings.Contains(req.ImageData, "data:image/png") {
-		img, err = png.Decode(bytes.NewReader(imageData))
+	data := []byte(args[0].String())
+	var format interop.Format
+	var err error
+	if len(args) == 2 {
+		format, err = interop.ParseFormat(args[1].String())
 	} else {
-		img, err = jpeg.Decode(bytes.NewReader(imageData))
+		format, err = interop.DetectFormat(data)
+	}
+	if err != nil {
+		return errorResult(err)
 	}
+
+	config, warnings, err := interop.Import(format, data)
+	if err != nil {
+		result := errorResult(err)
+		result["warnings"] = warningList(warnings)
+		return result
+	}
+	configJSON, err := json.Marshal(config)
 	if err != nil {
 		return map[string]interface{}{
-			"error": fmt.Sprintf("Failed to decode image: %v", err),
+			"error": fmt.Sprintf("Failed to marshal config: %v", err),
 		}
 	}
-	if debugMode {
-		fmt.Printf("DEBUG: Image decode took %v\n", time.Since(start))
-	}
 
-	// Convert to ntscImage
-	start = time.Now()
-	ntscImg := ntscImage.FromGoImage(img)
-	if debugMode {
-		fmt.Printf("DEBUG: FromGoImage took %v\n", time.Since(start))
+	return map[string]interface{}{
+		"config":   string(configJSON),
+		"format":   string(format),
+		"warnings": warningList(warnings),
 	}
+}
 
-	maxWidth := req.MaxWidth
-	maxHeight := req.MaxHeight
-
-	// Resize image
-	if maxWidth > 0 || maxHeight > 0 {
-		start = time.Now()
-		ntscImg = ntscImg.Resize(maxWidth, maxHeight)
-		if debugMode {
-			fmt.Printf("DEBUG: Resize took %v\n", time.Since(start))
+// exportPreset converts a config, which may be partial, into a preset of the
+// format named by the first argument.
+func exportPreset(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		return map[string]interface{}{
+			"error": "Invalid number of arguments",
 		}
 	}
 
-	processor := ntsc.NewNtscProcessor(req.Config)
-
-	// Process image with video context
-	start = time.Now()
-	processedImg := processor.ProcessImage(ntscImg)
-	if debugMode {
-		fmt.Printf("DEBUG: ProcessImage took %v\n", time.Since(start))
+	format, err := interop.ParseFormat(args[0].String())
+	if err != nil {
+		return errorResult(err)
+	}
+	config, err := preset.Decode([]byte(args[1].String()))
+	if err != nil {
+		return errorResult(err)
 	}
 
-	// Convert back to Go image
-	start = time.Now()
-	resultImg := processedImg.ToGoImage()
-	if debugMode {
-		fmt.Printf("DEBUG: ToGoImage took %v\n", time.Since(start))
+	data, warnings, err := interop.Export(format, config)
+	if err != nil {
+		return errorResult(err)
+	}
+	return map[string]interface{}{
+		"preset":   string(data),
+		"warnings": warningList(warnings),
 	}
+}
 
-	// Encode result image
-	start = time.Now()
-	var buf bytes.Buffer
-	encoder := png.Encoder{CompressionLevel: png.NoCompression}
-	if err := encoder.Encode(&buf, resultImg); err != nil {
+// encodeToken packs a config, which may be partial, into a shareable token.
+func encodeToken(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
 		return map[string]interface{}{
-			"error": fmt.Sprintf("Failed to encode result image: %v", err),
+			"error": "Invalid number of arguments",
 		}
 	}
-	if debugMode {
-		fmt.Printf("DEBUG: Image encode took %v\n", time.Since(start))
+
+	config, err := preset.Decode([]byte(args[0].String()))
+	if err != nil {
+		return errorResult(err)
 	}
+	if err := config.Validate(); err != nil {
+		return errorResult(err)
+	}
+	return map[string]interface{}{
+		"token": ntsc.EncodeToken(config),
+	}
+}
 
-	// Encode to base64
-	start = time.Now()
-	resultData := base64.StdEncoding.EncodeToString(buf.Bytes())
-	if debugMode {
-		fmt.Printf("DEBUG: Base64 encode took %v\n", time.Since(start))
+// decodeToken returns the config packed in a token as a JSON string.
+func decodeToken(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return map[string]interface{}{
+			"error": "Invalid number of arguments",
+		}
 	}
 
-	if debugMode {
-		fmt.Printf("DEBUG: Total processVideoFrame took %v\n", time.Since(startTotal))
+	config, err := ntsc.DecodeToken(strings.TrimSpace(args[0].String()))
+	if err != nil {
+		return errorResult(err)
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to marshal config: %v", err),
+		}
 	}
 	return map[string]interface{}{
-		"imageData": "data:image/png;base64," + resultData,
-		"frameNumber": req.FrameNumber,
+		"config": string(configJSON),
 	}
 }
 
-func getPreset(this js.Value, args []js.Value) interface{} {
+// readRecipe returns the recipe embedded in a PNG or JPEG data URL, and its
+// config on its own, as JSON strings.
+func readRecipe(this js.Value, args []js.Value) interface{} {
 	if len(args) != 1 {
 		return map[string]interface{}{
 			"error": "Invalid number of arguments",
 		}
 	}
 
-	presetName := args[0].String()
-	var config *ntsc.NtscConfig
-
-	switch presetName {
-	case "default":
-		config = ntsc.DefaultNtscConfig()
-	case "composite":
-		config = ntsc.DefaultNtscConfig()
-		config.CompositePreemphasis = 0.8
-		config.ColorBleedHoriz = int(0.6 * 10)
-		config.Ringing = 0.4
-	case "vhs":
-		config = ntsc.DefaultNtscConfig()
-		config.EmulatingVHS = true
-		config.VHSChromaVertBlend = true
-		config.VHSOutSharpen = 0.4
-		config.VHSEdgeWave = int(0.2 * 100)
-		config.VideoChromaLoss = int(0.3 * 100)
-	case "broadcast":
-		config = ntsc.DefaultNtscConfig()
-		config.VideoNoise = int(0.1 * 100)
-		config.VideoChromaNoise = int(0.05 * 100)
-		config.VideoChromaPhaseNoise = int(0.02 * 100)
-	default:
-		config = ntsc.DefaultNtscConfig()
+	dataURL := args[0].String()
+	if i := strings.Index(dataURL, ";base64,"); i >= 0 {
+		dataURL = dataURL[i+len(";base64,"):]
+	}
+	data, err := base64.StdEncoding.DecodeString(dataURL)
+	if err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to decode image data: %v", err),
+		}
 	}
 
-	configJSON, err := json.Marshal(config)
+	recipe, err := artifact.ReadRecipe(data)
+	if err != nil {
+		return errorResult(err)
+	}
+	recipeJSON, err := json.Marshal(recipe)
+	if err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to marshal recipe: %v", err),
+		}
+	}
+	configJSON, err := json.Marshal(recipe.Config)
 	if err != nil {
 		return map[string]interface{}{
 			"error": fmt.Sprintf("Failed to marshal config: %v", err),
 		}
 	}
-
 	return map[string]interface{}{
+		"recipe": string(recipeJSON),
 		"config": string(configJSON),
 	}
 }
 
+func warningList(warnings []interop.Warning) []interface{} {
+	list := make([]interface{}, len(warnings))
+	for i, w := range warnings {
+		list[i] = w.String()
+	}
+	return list
+}
+
+// setLimits replaces the resource limits of all following requests, see
+// LimitsRequest.
+func setLimits(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return map[string]interface{}{
+			"error": "Invalid number of arguments",
+		}
+	}
+
+	var req LimitsRequest
+	if err := json.Unmarshal([]byte(args[0].String()), &req); err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to parse limits: %v", err),
+		}
+	}
+	if req.MaxPixels < 0 || req.MaxMemoryMB < 0 || req.TimeoutMs < 0 {
+		return map[string]interface{}{
+			"error": "Limits must not be negative",
+		}
+	}
+	limits = artifact.Limits{
+		MaxPixels:   req.MaxPixels,
+		MaxMemory:   req.MaxMemoryMB << 20,
+		MaxDuration: time.Duration(req.TimeoutMs) * time.Millisecond,
+	}
+	return getLimits(this, nil)
+}
+
+func getLimits(this js.Value, args []js.Value) interface{} {
+	return map[string]interface{}{
+		"maxPixels":   limits.MaxPixels,
+		"maxMemoryMB": limits.MaxMemory >> 20,
+		"timeoutMs":   limits.MaxDuration.Milliseconds(),
+	}
+}
+
 func setDebugMode(this js.Value, args []js.Value) interface{} {
 	if len(args) != 1 {
 		return map[string]interface{}{
@@ -357,3 +633,25 @@ func getDebugMode(this js.Value, args []js.Value) interface{} {
 		"debugMode": debugMode,
 	}
 }
+
+// describeConfig returns the ntsc.Params metadata of every config field and
+// the JSON Schema of configs, both as JSON strings.
+func describeConfig(this js.Value, args []js.Value) interface{} {
+	paramsJSON, err := json.Marshal(ntsc.Params())
+	if err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to marshal params: %v", err),
+		}
+	}
+	schema, err := ntsc.ConfigSchema()
+	if err != nil {
+		return map[string]interface{}{
+			"error": fmt.Sprintf("Failed to build schema: %v", err),
+		}
+	}
+
+	return map[string]interface{}{
+		"params": string(paramsJSON),
+		"schema": string(schema),
+	}
+}
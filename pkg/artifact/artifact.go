@@ -0,0 +1,350 @@
+// Package artifact is the high-level entry point for embedding the simulator
+// in Go programs. It works on standard library images and encoded streams and
+// takes care of the conversion to and from the ntsc package's RGB buffers.
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	ntscImage "ntsc-wasm/pkg/image"
+	"ntsc-wasm/pkg/ntsc"
+	"ntsc-wasm/pkg/preset"
+	"strings"
+)
+
+// Format is an encoded image format understood by ProcessReader and Encode.
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+)
+
+// ParseFormat accepts a format name or file extension such as "png", "jpg"
+// or ".jpeg".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "png":
+		return FormatPNG, nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	default:
+		return "", fmt.Errorf("artifact: unsupported format %q", name)
+	}
+}
+
+type options struct {
+	ctx         context.Context
+	progress    ntsc.ProgressFunc
+	observer    ntsc.Observer
+	config      *ntsc.NtscConfig
+	configJSON  []byte
+	pipeline    ntsc.Pipeline
+	presetName  string
+	seed        uint32
+	hasSeed     bool
+	maxWidth    int
+	maxHeight   int
+	outWidth    int
+	outHeight   int
+	format      Format
+	jpegQuality int
+	recipe      bool
+	limits      Limits
+}
+
+// Option configures Process and ProcessReader.
+type Option func(*options)
+
+// WithConfig processes with a copy of config. It takes precedence over
+// WithPreset.
+func WithConfig(config *ntsc.NtscConfig) Option {
+	return func(o *options) {
+		o.config = config
+	}
+}
+
+// WithConfigJSON overlays a partial JSON config, see preset.Decode. Omitted
+// fields keep the values of its "base" preset, of WithConfig or WithPreset, or
+// of the defaults.
+func WithConfigJSON(data []byte) Option {
+	return func(o *options) {
+		o.configJSON = data
+	}
+}
+
+// WithPipeline replaces the default stage pipeline.
+func WithPipeline(pipeline ntsc.Pipeline) Option {
+	return func(o *options) {
+		o.pipeline = pipeline
+	}
+}
+
+// WithPreset starts from the named preset of preset.Default instead of the
+// defaults.
+func WithPreset(name string) Option {
+	return func(o *options) {
+		o.presetName = name
+	}
+}
+
+// WithSeed overrides the config's RandomSeed.
+func WithSeed(seed uint32) Option {
+	return func(o *options) {
+		o.seed = seed
+		o.hasSeed = true
+	}
+}
+
+// WithMaxSize downscales the input to fit within width x height before
+// processing. Zero leaves that dimension unconstrained.
+func WithMaxSize(width, height int) Option {
+	return func(o *options) {
+		o.maxWidth = width
+		o.maxHeight = height
+	}
+}
+
+// WithOutputSize scales the result to width x height. Zero derives that
+// dimension from the other and the aspect ratio of the processed image, and
+// both zero keep its size. With NtscConfig.Resample the result is scaled
+// straight from the standard's resolution.
+func WithOutputSize(width, height int) Option {
+	return func(o *options) {
+		o.outWidth = width
+		o.outHeight = height
+	}
+}
+
+// outputSize returns the size of the result for a processed width x height
+// image.
+func (o *options) outputSize(width, height int) (int, int) {
+	switch {
+	case o.outWidth > 0 && o.outHeight > 0:
+		return o.outWidth, o.outHeight
+	case o.outWidth > 0:
+		return o.outWidth, max(1, height*o.outWidth/width)
+	case o.outHeight > 0:
+		return max(1, width*o.outHeight/height), o.outHeight
+	}
+	return width, height
+}
+
+// WithFormat selects the output format of ProcessReader. By default the
+// input format is kept.
+func WithFormat(format Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithJPEGQuality sets the quality used for JPEG output.
+func WithJPEGQuality(quality int) Option {
+	return func(o *options) {
+		o.jpegQuality = quality
+	}
+}
+
+// WithLimits replaces DefaultLimits. A zero Limits disables all checks.
+func WithLimits(limits Limits) Option {
+	return func(o *options) {
+		o.limits = limits
+	}
+}
+
+// WithRecipe makes ProcessReader embed the Recipe of the output in its
+// metadata, see EmbedRecipe.
+func WithRecipe() Option {
+	return func(o *options) {
+		o.recipe = true
+	}
+}
+
+// WithContext makes processing stop with ctx.Err() once ctx is done.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithProgress reports per-stage progress, see ntsc.ProgressFunc.
+func WithProgress(progress ntsc.ProgressFunc) Option {
+	return func(o *options) {
+		o.progress = progress
+	}
+}
+
+// WithObserver reports every stage to observer, see ntsc.Observer.
+func WithObserver(observer ntsc.Observer) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		ctx:         context.Background(),
+		jpegQuality: 95,
+		limits:      DefaultLimits,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) resolveConfig() (*ntsc.NtscConfig, error) {
+	var config *ntsc.NtscConfig
+	switch {
+	case o.config != nil:
+		copied := *o.config
+		config = &copied
+	case o.presetName != "":
+		var err error
+		if config, err = preset.Get(o.presetName); err != nil {
+			return nil, err
+		}
+	default:
+		config = ntsc.DefaultNtscConfig()
+	}
+
+	if o.configJSON != nil {
+		var err error
+		if config, err = preset.DecodeOnto(config, o.configJSON); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.hasSeed {
+		config.RandomSeed = o.seed
+	}
+	return config, nil
+}
+
+// Process applies the simulator to src and returns a new image.
+func Process(src image.Image, opts ...Option) (image.Image, error) {
+	result, _, err := process(src, newOptions(opts))
+	return result, err
+}
+
+// process returns the processed image and the config it used.
+func process(src image.Image, o *options) (image.Image, *ntsc.NtscConfig, error) {
+	config, err := o.resolveConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bounds := src.Bounds()
+	if err := o.limits.Check(bounds.Dx(), bounds.Dy(), o.maxWidth, o.maxHeight); err != nil {
+		return nil, nil, err
+	}
+
+	img := ntscImage.FromGoImage(src)
+	if o.maxWidth > 0 || o.maxHeight > 0 {
+		img = img.Resize(o.maxWidth, o.maxHeight)
+	}
+
+	processor, err := ntsc.NewNtscProcessor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	processor.Pipeline = o.pipeline
+	processor.Observer = o.observer
+
+	dst := img
+	if width, height := o.outputSize(img.Width, img.Height); width != img.Width || height != img.Height {
+		if err := o.limits.Check(width, height, 0, 0); err != nil {
+			return nil, nil, err
+		}
+		dst = ntscImage.NewImage(width, height)
+	}
+
+	ctx, cancel := o.limits.WithTimeout(o.ctx)
+	defer cancel()
+	if config.Resample {
+		err = processor.ProcessIntoContext(ctx, dst, img, o.progress)
+	} else {
+		err = processor.ProcessIntoContext(ctx, img, img, o.progress)
+		img.ScaleInto(dst)
+	}
+	if err != nil {
+		return nil, nil, o.limits.Err(ctx, err)
+	}
+	return dst.ToGoImage(), config, nil
+}
+
+// ProcessReader decodes a PNG or JPEG image from r, processes it and encodes
+// the result to w. The image header is checked against the limits before
+// the image is decoded.
+func ProcessReader(r io.Reader, w io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("artifact: failed to read image: %v", err)
+	}
+	if _, _, err := o.limits.CheckHeader(data, o.maxWidth, o.maxHeight); err != nil {
+		return err
+	}
+	src, name, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("artifact: failed to decode image: %v", err)
+	}
+
+	format := o.format
+	if format == "" {
+		if format, err = ParseFormat(name); err != nil {
+			return err
+		}
+	}
+
+	result, config, err := process(src, o)
+	if err != nil {
+		return err
+	}
+	if !o.recipe {
+		return Encode(w, result, format, o.jpegQuality)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, result, format, o.jpegQuality); err != nil {
+		return err
+	}
+	presetName := ""
+	if o.config == nil {
+		presetName = o.presetName
+	}
+	if base := preset.BaseName(o.configJSON); base != "" {
+		presetName = base
+	}
+	output, err := EmbedRecipe(buf.Bytes(), format, NewRecipe(config, presetName, o.pipeline))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(output); err != nil {
+		return fmt.Errorf("artifact: %v", err)
+	}
+	return nil
+}
+
+// Encode writes img to w in the given format. jpegQuality is ignored for PNG.
+func Encode(w io.Writer, img image.Image, format Format, jpegQuality int) error {
+	var err error
+	switch format {
+	case FormatPNG:
+		err = png.Encode(w, img)
+	case FormatJPEG:
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	default:
+		return fmt.Errorf("artifact: unsupported format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("artifact: failed to encode image: %v", err)
+	}
+	return nil
+}
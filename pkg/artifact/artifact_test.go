@@ -0,0 +1,154 @@
+package artifact
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"ntsc-wasm/pkg/ntsc"
+	"testing"
+)
+
+// testImage draws a small gradient, large enough for every stage.
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestOptionPrecedence(t *testing.T) {
+	resolve := func(opts ...Option) *ntsc.NtscConfig {
+		t.Helper()
+		config, err := newOptions(opts).resolveConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+
+	if config := resolve(); config.EmulatingVHS {
+		t.Error("defaults emulate VHS")
+	}
+	if config := resolve(WithPreset("vhs")); !config.EmulatingVHS {
+		t.Error("vhs preset does not emulate VHS")
+	}
+
+	// An explicit config replaces the preset, and is copied
+	own := ntsc.DefaultNtscConfig()
+	own.VideoNoise = 7
+	config := resolve(WithPreset("vhs"), WithConfig(own))
+	if config.EmulatingVHS || config.VideoNoise != 7 {
+		t.Errorf("config did not replace the preset: EmulatingVHS %v, VideoNoise %d", config.EmulatingVHS, config.VideoNoise)
+	}
+	config.VideoNoise = 8
+	if own.VideoNoise != 7 {
+		t.Error("resolving modified the caller's config")
+	}
+
+	// A JSON config overlays the preset or config, field by field
+	config = resolve(WithPreset("vhs"), WithConfigJSON([]byte(`{"VideoNoise": 9, "RandomSeed": 3}`)))
+	if !config.EmulatingVHS || config.VideoNoise != 9 || config.RandomSeed != 3 {
+		t.Errorf("JSON did not overlay the preset: EmulatingVHS %v, VideoNoise %d, RandomSeed %d",
+			config.EmulatingVHS, config.VideoNoise, config.RandomSeed)
+	}
+
+	// The seed applies last, whatever the config came from
+	for _, opts := range [][]Option{
+		{WithSeed(42)},
+		{WithPreset("vhs"), WithSeed(42)},
+		{WithSeed(42), WithConfig(own)},
+		{WithSeed(42), WithConfigJSON([]byte(`{"RandomSeed": 3}`))},
+	} {
+		if config := resolve(opts...); config.RandomSeed != 42 {
+			t.Errorf("seed is %d, want 42", config.RandomSeed)
+		}
+	}
+}
+
+func TestProcessReaderFormats(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		opts []Option
+		want string
+	}{
+		{nil, "png"},
+		{[]Option{WithFormat(FormatJPEG), WithJPEGQuality(80)}, "jpeg"},
+	} {
+		var out bytes.Buffer
+		if err := ProcessReader(bytes.NewReader(src.Bytes()), &out, c.opts...); err != nil {
+			t.Fatal(err)
+		}
+		img, format, err := image.Decode(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != c.want || img.Bounds().Size() != image.Pt(64, 48) {
+			t.Errorf("output is %s %v, want %s 64x48", format, img.Bounds().Size(), c.want)
+		}
+	}
+
+	// A JPEG input comes back as JPEG
+	var jpg, out bytes.Buffer
+	if err := jpeg.Encode(&jpg, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ProcessReader(&jpg, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, format, err := image.Decode(&out); err != nil || format != "jpeg" {
+		t.Errorf("JPEG input came back as %q, %v", format, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Process(testImage(), WithPreset("no-such-preset")); err == nil {
+		t.Error("unknown preset accepted")
+	}
+	for _, name := range []string{"gif", ".bmp", ""} {
+		if _, err := ParseFormat(name); err == nil {
+			t.Errorf("format %q accepted", name)
+		}
+	}
+	var src, out bytes.Buffer
+	if err := png.Encode(&src, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ProcessReader(&src, &out, WithFormat("gif")); err == nil {
+		t.Error("gif output accepted")
+	}
+	if err := ProcessReader(bytes.NewReader([]byte("not an image")), &out); err == nil {
+		t.Error("garbage input decoded")
+	}
+}
+
+func TestOutputSize(t *testing.T) {
+	src := colorBars() // 70x48
+	for _, c := range []struct {
+		config        string
+		width, height int
+		want          image.Point
+	}{
+		{`{}`, 0, 0, image.Pt(70, 48)},
+		{`{}`, 140, 0, image.Pt(140, 96)},
+		{`{}`, 0, 24, image.Pt(35, 24)},
+		{`{"Resample": true}`, 0, 0, image.Pt(70, 48)},
+		{`{"Resample": true}`, 100, 30, image.Pt(100, 30)},
+	} {
+		got, err := Process(src, WithConfigJSON([]byte(c.config)), WithOutputSize(c.width, c.height))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := got.Bounds().Size(); size != c.want {
+			t.Errorf("%s at %dx%d: output is %v, want %v", c.config, c.width, c.height, size, c.want)
+		}
+	}
+}
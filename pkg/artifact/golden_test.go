@@ -0,0 +1,242 @@
+package artifact
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"ntsc-wasm/pkg/ntsc"
+	"ntsc-wasm/pkg/preset"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata/golden")
+
+const goldenDir = "testdata/golden"
+
+// Outputs may drift slightly between architectures, since the compiler is
+// free to fuse float operations, so images match if their channels differ
+// by at most goldenMeanDiff on average and goldenOutliers of the samples
+// differ by more than goldenOutlierDiff.
+const (
+	goldenMeanDiff    = 1.0
+	goldenOutlierDiff = 16
+	goldenOutliers    = 0.002
+)
+
+// goldenInputs draws the reference inputs. The odd size of gradient covers
+// odd field heights and widths that are not a power of two.
+var goldenInputs = map[string]func() image.Image{
+	"bars":     colorBars,
+	"gradient": gradient,
+}
+
+type goldenCase struct {
+	name     string
+	input    string
+	options  []Option
+	pipeline string
+}
+
+func goldenCases() []goldenCase {
+	var cases []goldenCase
+	for _, name := range preset.Names() {
+		for input := range goldenInputs {
+			cases = append(cases, goldenCase{
+				name:    "preset-" + name + "-" + input,
+				input:   input,
+				options: []Option{WithPreset(name)},
+			})
+		}
+	}
+
+	stages := []struct {
+		name     string
+		config   string
+		pipeline string
+	}{
+		{"ringing", `{"Ringing": 0.5}`, ""},
+		{"ringing2", `{"Ringing": 0.5, "EnableRinging2": true, "RingingPower": 4, "RingingShift": 1}`, ""},
+		{"composite-preemphasis", `{"CompositePreemphasis": 4}`, ""},
+		{"video-noise", `{"VideoNoise": 100}`, ""},
+		{"chroma-noise", `{"VideoChromaNoise": 2000, "VideoChromaPhaseNoise": 20}`, ""},
+		{"head-switching", `{"VHSHeadSwitching": true, "HeadSwitchingSpeed": 50}`, ""},
+		{"color-bleed", `{"ColorBleedBefore": false, "ColorBleedHoriz": 5, "ColorBleedVert": 3}`, ""},
+		{"vhs-ep", `{"EmulatingVHS": true, "VHSEdgeWave": 4, "OutputVHSTapeSpeed": "EP"}`, ""},
+		{"chroma-loss", `{"VideoChromaLoss": 50000}`, ""},
+		{"pal", `{"VideoStandard": "PAL", "PALPhaseError": 20, "PALDelayLine": 0.5}`, ""},
+		{"secam", `{"VideoStandard": "SECAM"}`, ""},
+		{"resample", `{"Resample": true, "EmulatingVHS": true}`, ""},
+		// The composite round trip on its own
+		{"chroma-luma", `{}`, "chromaIntoLuma,chromaFromLuma"},
+	}
+	for _, s := range stages {
+		cases = append(cases, goldenCase{
+			name:     "stage-" + s.name,
+			input:    "bars",
+			options:  []Option{WithConfigJSON([]byte(s.config))},
+			pipeline: s.pipeline,
+		})
+	}
+	return cases
+}
+
+func TestGolden(t *testing.T) {
+	for name, draw := range goldenInputs {
+		path := filepath.Join(goldenDir, "inputs", name+".png")
+		if _, err := os.Stat(path); os.IsNotExist(err) && *update {
+			writePNG(t, path, draw())
+		}
+	}
+
+	for _, c := range goldenCases() {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			src := readPNG(t, filepath.Join(goldenDir, "inputs", c.input+".png"))
+
+			opts := append([]Option{WithLimits(Limits{})}, c.options...)
+			if c.pipeline != "" {
+				pipeline, err := ntsc.NewPipeline(strings.Split(c.pipeline, ",")...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts = append(opts, WithPipeline(pipeline))
+			}
+			got, err := Process(src, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(goldenDir, c.name+".png")
+			if *update {
+				writePNG(t, path, got)
+				return
+			}
+			want := readPNG(t, path)
+			if err := compareImages(got, want); err != nil {
+				actual := filepath.Join(os.TempDir(), "ntsc-golden", c.name+".png")
+				writePNG(t, actual, got)
+				t.Errorf("%v; output written to %s, rerun with -update to accept it", err, actual)
+			}
+		})
+	}
+}
+
+// compareImages returns an error if got and want differ by more than the
+// golden tolerances.
+func compareImages(got, want image.Image) error {
+	if got.Bounds().Size() != want.Bounds().Size() {
+		return fmt.Errorf("size is %v, want %v", got.Bounds().Size(), want.Bounds().Size())
+	}
+	var sum, outliers, samples int
+	maxDiff := 0
+	gb, wb := got.Bounds(), want.Bounds()
+	for y := 0; y < gb.Dy(); y++ {
+		for x := 0; x < gb.Dx(); x++ {
+			g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y)).(color.NRGBA)
+			w := color.NRGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y)).(color.NRGBA)
+			for _, d := range []int{int(g.R) - int(w.R), int(g.G) - int(w.G), int(g.B) - int(w.B)} {
+				if d < 0 {
+					d = -d
+				}
+				sum += d
+				samples++
+				if d > goldenOutlierDiff {
+					outliers++
+				}
+				if d > maxDiff {
+					maxDiff = d
+				}
+			}
+		}
+	}
+	mean := float64(sum) / float64(samples)
+	fraction := float64(outliers) / float64(samples)
+	if mean > goldenMeanDiff || fraction > goldenOutliers {
+		return fmt.Errorf("mean difference %.3f, %.2f%% of samples off by more than %d, at most %d",
+			mean, fraction*100, goldenOutlierDiff, maxDiff)
+	}
+	return nil
+}
+
+func readPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -run TestGolden -update to create it", err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return img
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// colorBars draws 75% color bars over a gray ramp.
+func colorBars() image.Image {
+	bars := []color.RGBA{
+		{191, 191, 191, 255}, {191, 191, 0, 255}, {0, 191, 191, 255}, {0, 191, 0, 255},
+		{191, 0, 191, 255}, {191, 0, 0, 255}, {0, 0, 191, 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 70, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 70; x++ {
+			c := bars[x/10]
+			if y >= 36 {
+				v := uint8(x * 255 / 69)
+				c = color.RGBA{v, v, v, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// gradient draws smooth hue and brightness gradients crossed by a sharp
+// diagonal edge.
+func gradient() image.Image {
+	const width, height = 61, 37
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			hue := float64(x) / width * 2 * math.Pi
+			level := 0.3 + 0.7*float64(y)/height
+			c := color.RGBA{
+				uint8(255 * level * (0.5 + 0.5*math.Cos(hue))),
+				uint8(255 * level * (0.5 + 0.5*math.Cos(hue-2*math.Pi/3))),
+				uint8(255 * level * (0.5 + 0.5*math.Cos(hue+2*math.Pi/3))),
+				255,
+			}
+			if x > y*2 {
+				c = color.RGBA{c.R / 4, c.G / 4, c.B / 4, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
@@ -0,0 +1,96 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	ntscImage "ntsc-wasm/pkg/image"
+	"ntsc-wasm/pkg/ntsc"
+	"time"
+)
+
+// ErrLimitExceeded is wrapped by every error caused by a Limits check.
+var ErrLimitExceeded = errors.New("artifact: resource limit exceeded")
+
+// Limits bounds the resources spent on one image. Zero fields are
+// unlimited.
+type Limits struct {
+	// MaxPixels is checked against the width and height in the image header
+	// before the image is decoded.
+	MaxPixels int64
+	// MaxMemory bounds EstimateMemory.
+	MaxMemory int64
+	// MaxDuration bounds the time spent processing.
+	MaxDuration time.Duration
+}
+
+// DefaultLimits are used by Process and ProcessReader unless WithLimits
+// replaces them. They stay well below the 4 GiB a wasm module can address.
+var DefaultLimits = Limits{
+	MaxPixels: 100_000_000,
+	MaxMemory: 2 << 30,
+}
+
+// EstimateMemory returns the bytes needed to process a width x height image
+// downscaled to fit maxWidth x maxHeight: the decoded source and its RGB
+// copy, the resized copy, the processor's YIQ planes and the output image.
+func EstimateMemory(width, height, maxWidth, maxHeight int) int64 {
+	src := int64(width) * int64(height)
+	w, h := width, height
+	if maxWidth > 0 || maxHeight > 0 {
+		w, h = ntscImage.ResizedSize(width, height, maxWidth, maxHeight)
+	}
+	out := int64(w) * int64(h)
+	return src*(4+3) + out*(3+4) + ntsc.EstimateMemory(w, h)
+}
+
+// Check returns an error wrapping ErrLimitExceeded if a width x height
+// image, downscaled to fit maxWidth x maxHeight, exceeds l.
+func (l Limits) Check(width, height, maxWidth, maxHeight int) error {
+	if pixels := int64(width) * int64(height); l.MaxPixels > 0 && pixels > l.MaxPixels {
+		return fmt.Errorf("%w: %dx%d is %d pixels, the limit is %d", ErrLimitExceeded, width, height, pixels, l.MaxPixels)
+	}
+	if memory := EstimateMemory(width, height, maxWidth, maxHeight); l.MaxMemory > 0 && memory > l.MaxMemory {
+		return fmt.Errorf("%w: processing %dx%d needs about %d MiB, the limit is %d MiB",
+			ErrLimitExceeded, width, height, memory>>20, l.MaxMemory>>20)
+	}
+	return nil
+}
+
+// CheckHeader reads only the header of an encoded image and checks its size
+// against l, so oversized images are rejected before they are decoded. It
+// returns the header and the format name.
+func (l Limits) CheckHeader(data []byte, maxWidth, maxHeight int) (image.Config, string, error) {
+	header, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("artifact: failed to decode image header: %v", err)
+	}
+	if err := l.Check(header.Width, header.Height, maxWidth, maxHeight); err != nil {
+		return image.Config{}, "", err
+	}
+	return header, format, nil
+}
+
+// WithTimeout returns a context that is done after MaxDuration, if set.
+// Pass errors from work under it through Err to report a timeout as a
+// limit error.
+func (l Limits) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.MaxDuration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	cause := fmt.Errorf("%w: processing took longer than %v", ErrLimitExceeded, l.MaxDuration)
+	return context.WithTimeoutCause(ctx, l.MaxDuration, cause)
+}
+
+// Err replaces err by the limit error if ctx, returned by WithTimeout, timed
+// out.
+func (l Limits) Err(ctx context.Context, err error) error {
+	if err != nil && errors.Is(err, context.DeadlineExceeded) {
+		if cause := context.Cause(ctx); errors.Is(cause, ErrLimitExceeded) {
+			return cause
+		}
+	}
+	return err
+}
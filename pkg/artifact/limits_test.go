@@ -0,0 +1,55 @@
+package artifact
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"testing"
+	"time"
+)
+
+// bombPNG returns a PNG whose header claims width x height pixels but whose
+// data is empty, so only a header check can reject it cheaply.
+func bombPNG(width, height uint32) []byte {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	ihdr := binary.BigEndian.AppendUint32(nil, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0)
+	writePNGChunk(&buf, "IHDR", ihdr)
+	writePNGChunk(&buf, "IEND", nil)
+	return buf.Bytes()
+}
+
+func TestLimits(t *testing.T) {
+	var out bytes.Buffer
+	err := ProcessReader(bytes.NewReader(bombPNG(50000, 50000)), &out)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("pixel limit: got %v, want ErrLimitExceeded", err)
+	}
+
+	// Downscaling shrinks the estimate, but the decoded source still counts
+	limits := Limits{MaxMemory: EstimateMemory(32, 16, 8, 0)}
+	if err := limits.Check(32, 16, 8, 0); err != nil {
+		t.Errorf("estimate at the limit: %v", err)
+	}
+	if err := limits.Check(32, 16, 0, 0); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("memory limit: got %v, want ErrLimitExceeded", err)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(testPNG(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Process(src, WithLimits(Limits{MaxDuration: time.Nanosecond}))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("time limit: got %v, want ErrLimitExceeded", err)
+	}
+
+	err = ProcessReader(bytes.NewReader(testPNG(t)), io.Discard, WithLimits(Limits{}))
+	if err != nil {
+		t.Errorf("no limits: %v", err)
+	}
+}
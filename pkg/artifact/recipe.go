@@ -0,0 +1,236 @@
+package artifact
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"ntsc-wasm/pkg/ntsc"
+	"runtime/debug"
+)
+
+// Version is the tool version written into recipes. Builds can set it with
+// -ldflags "-X ntsc-wasm/pkg/artifact.Version=..."; otherwise it is taken
+// from the build info.
+var Version = ""
+
+// RecipeKey is the PNG text keyword, and the JPEG comment prefix, under
+// which recipes are stored.
+const RecipeKey = "ntsc-recipe"
+
+// ErrNoRecipe is returned by ReadRecipe for images without a recipe.
+var ErrNoRecipe = errors.New("artifact: image has no recipe")
+
+// Recipe records how an image was processed. Config is the complete resolved
+// config, so it reproduces the output exactly; Seed and Preset repeat what a
+// reader most likely looks for.
+type Recipe struct {
+	Tool     string           `json:"tool"`
+	Version  string           `json:"version"`
+	Preset   string           `json:"preset,omitempty"`
+	Seed     uint32           `json:"seed"`
+	Pipeline []string         `json:"pipeline,omitempty"`
+	Config   *ntsc.NtscConfig `json:"config"`
+}
+
+// NewRecipe returns the recipe of an image processed with config and, if not
+// nil, pipeline. presetName may be empty.
+func NewRecipe(config *ntsc.NtscConfig, presetName string, pipeline ntsc.Pipeline) *Recipe {
+	copied := *config
+	recipe := &Recipe{
+		Tool:    "ntsc-wasm",
+		Version: toolVersion(),
+		Preset:  presetName,
+		Seed:    config.RandomSeed,
+		Config:  &copied,
+	}
+	if pipeline != nil {
+		recipe.Pipeline = pipeline.Names()
+	}
+	return recipe
+}
+
+func toolVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return s.Value[:12]
+		}
+	}
+	return info.Main.Version
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// EmbedRecipe adds recipe to an encoded PNG or JPEG image. PNGs get an
+// uncompressed iTXt chunk and a Software tEXt chunk, JPEGs a comment
+// segment.
+func EmbedRecipe(data []byte, format Format, recipe *Recipe) ([]byte, error) {
+	recipeJSON, err := json.Marshal(recipe)
+	if err != nil {
+		return nil, fmt.Errorf("artifact: %v", err)
+	}
+
+	switch format {
+	case FormatPNG:
+		// Insert the chunks before IEND, the last 12 bytes of the stream
+		if len(data) < len(pngSignature)+12 || !bytes.HasPrefix(data, pngSignature) {
+			return nil, fmt.Errorf("artifact: not a PNG image")
+		}
+		end := len(data) - 12
+		if string(data[end+4:end+8]) != "IEND" {
+			return nil, fmt.Errorf("artifact: PNG does not end with IEND")
+		}
+		var out bytes.Buffer
+		out.Write(data[:end])
+		// iTXt: keyword, no compression, no language or translated keyword
+		itxt := append([]byte(RecipeKey), 0, 0, 0, 0, 0)
+		writePNGChunk(&out, "iTXt", append(itxt, recipeJSON...))
+		writePNGChunk(&out, "tEXt", []byte("Software\x00"+recipe.Tool+" "+recipe.Version))
+		out.Write(data[end:])
+		return out.Bytes(), nil
+
+	case FormatJPEG:
+		if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+			return nil, fmt.Errorf("artifact: not a JPEG image")
+		}
+		comment := append([]byte(RecipeKey+":"), recipeJSON...)
+		if len(comment)+2 > 0xffff {
+			return nil, fmt.Errorf("artifact: recipe too large for a JPEG comment")
+		}
+		var out bytes.Buffer
+		out.Write(data[:2])
+		out.Write([]byte{0xff, 0xfe})
+		binary.Write(&out, binary.BigEndian, uint16(len(comment)+2))
+		out.Write(comment)
+		out.Write(data[2:])
+		return out.Bytes(), nil
+
+	default:
+		return nil, fmt.Errorf("artifact: unsupported format %q", format)
+	}
+}
+
+func writePNGChunk(w *bytes.Buffer, kind string, body []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(body)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(body)
+	w.WriteString(kind)
+	w.Write(body)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// ReadRecipe returns the recipe embedded in an encoded PNG or JPEG image. The
+// error wraps ErrNoRecipe if there is none.
+func ReadRecipe(data []byte) (*Recipe, error) {
+	var recipeJSON []byte
+	var err error
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		recipeJSON, err = findPNGRecipe(data[len(pngSignature):])
+	case len(data) >= 2 && data[0] == 0xff && data[1] == 0xd8:
+		recipeJSON, err = findJPEGRecipe(data[2:])
+	default:
+		return nil, fmt.Errorf("artifact: not a PNG or JPEG image")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recipe := Recipe{Config: ntsc.DefaultNtscConfig()}
+	if err := json.Unmarshal(recipeJSON, &recipe); err != nil {
+		return nil, fmt.Errorf("artifact: invalid recipe: %v", err)
+	}
+	if err := recipe.Config.Validate(); err != nil {
+		return nil, err
+	}
+	return &recipe, nil
+}
+
+func findPNGRecipe(data []byte) ([]byte, error) {
+	for len(data) >= 12 {
+		length := binary.BigEndian.Uint32(data)
+		if uint64(length) > uint64(len(data)-12) {
+			break
+		}
+		kind, body := string(data[4:8]), data[8:8+length]
+		data = data[12+length:]
+
+		switch kind {
+		case "tEXt":
+			if text, ok := bytes.CutPrefix(body, []byte(RecipeKey+"\x00")); ok {
+				return text, nil
+			}
+		case "iTXt":
+			if text, ok := bytes.CutPrefix(body, []byte(RecipeKey+"\x00")); ok {
+				return parseITXt(text)
+			}
+		case "IEND":
+			return nil, ErrNoRecipe
+		}
+	}
+	return nil, ErrNoRecipe
+}
+
+// parseITXt returns the text of an iTXt chunk body that follows the keyword.
+func parseITXt(body []byte) ([]byte, error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("artifact: truncated iTXt chunk")
+	}
+	compressed := body[0] == 1
+	// Skip the language tag and the translated keyword
+	rest := body[2:]
+	for i := 0; i < 2; i++ {
+		n := bytes.IndexByte(rest, 0)
+		if n < 0 {
+			return nil, fmt.Errorf("artifact: truncated iTXt chunk")
+		}
+		rest = rest[n+1:]
+	}
+	if !compressed {
+		return rest, nil
+	}
+	r, err := zlib.NewReader(bytes.NewReader(rest))
+	if err != nil {
+		return nil, fmt.Errorf("artifact: invalid iTXt chunk: %v", err)
+	}
+	defer r.Close()
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("artifact: invalid iTXt chunk: %v", err)
+	}
+	return text, nil
+}
+
+func findJPEGRecipe(data []byte) ([]byte, error) {
+	for len(data) >= 4 && data[0] == 0xff {
+		marker := data[1]
+		// Scan data follows the start of scan marker; comments come before
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if length < 2 || length+2 > len(data) {
+			break
+		}
+		body := data[4 : 2+length]
+		data = data[2+length:]
+		if marker == 0xfe {
+			if text, ok := bytes.CutPrefix(body, []byte(RecipeKey+":")); ok {
+				return text, nil
+			}
+		}
+	}
+	return nil, ErrNoRecipe
+}
@@ -0,0 +1,66 @@
+package artifact
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func testPNG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 16), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRecipeRoundTrip(t *testing.T) {
+	src := testPNG(t)
+	for _, format := range []Format{FormatPNG, FormatJPEG} {
+		var out bytes.Buffer
+		err := ProcessReader(bytes.NewReader(src), &out,
+			WithPreset("vhs"),
+			WithConfigJSON([]byte(`{"VideoNoise": 30}`)),
+			WithSeed(99),
+			WithFormat(format),
+			WithRecipe())
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(out.Bytes())); err != nil {
+			t.Fatalf("%s: output no longer decodes: %v", format, err)
+		}
+
+		recipe, err := ReadRecipe(out.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		want, err := newOptions([]Option{
+			WithPreset("vhs"),
+			WithConfigJSON([]byte(`{"VideoNoise": 30}`)),
+			WithSeed(99),
+		}).resolveConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *recipe.Config != *want {
+			t.Errorf("%s: recipe config\n%+v\nwant\n%+v", format, *recipe.Config, *want)
+		}
+		if recipe.Preset != "vhs" || recipe.Seed != 99 || recipe.Version == "" {
+			t.Errorf("%s: recipe %+v", format, recipe)
+		}
+	}
+
+	if _, err := ReadRecipe(src); !errors.Is(err, ErrNoRecipe) {
+		t.Errorf("got %v, want ErrNoRecipe", err)
+	}
+}
@@ -159,30 +159,42 @@ func (img *Image) ToGoImage() image.Image {
 	return goImg
 }
 
-func (img *Image) Resize(maxWidth, maxHeight int) *Image {
-	if maxWidth <= 0 && maxHeight <= 0 {
-		return img.Clone()
+// ResizedSize returns the size Resize produces for a width x height image.
+func ResizedSize(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := resizeScale(width, height, maxWidth, maxHeight)
+	if scale >= 1.0 {
+		return width, height
 	}
+	return int(float64(width) * scale), int(float64(height) * scale)
+}
 
-	originalWidth := float64(img.Width)
-	originalHeight := float64(img.Height)
-
+func resizeScale(width, height, maxWidth, maxHeight int) float64 {
 	var scaleX, scaleY float64 = 1.0, 1.0
 
 	if maxWidth > 0 {
-		scaleX = float64(maxWidth) / originalWidth
+		scaleX = float64(maxWidth) / float64(width)
 	}
 	if maxHeight > 0 {
-		scaleY = float64(maxHeight) / originalHeight
+		scaleY = float64(maxHeight) / float64(height)
+	}
+
+	return math.Min(scaleX, scaleY)
+}
+
+func (img *Image) Resize(maxWidth, maxHeight int) *Image {
+	if maxWidth <= 0 && maxHeight <= 0 {
+		return img.Clone()
 	}
 
-	scale := math.Min(scaleX, scaleY)
+	originalWidth := float64(img.Width)
+	originalHeight := float64(img.Height)
+
+	scale := resizeScale(img.Width, img.Height, maxWidth, maxHeight)
 	if scale >= 1.0 {
 		return img.Clone()
 	}
 
-	newWidth := int(originalWidth * scale)
-	newHeight := int(originalHeight * scale)
+	newWidth, newHeight := ResizedSize(img.Width, img.Height, maxWidth, maxHeight)
 
 	resized := NewImage(newWidth, newHeight)
 
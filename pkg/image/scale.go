@@ -0,0 +1,91 @@
+package image
+
+import "math"
+
+// Scale returns a copy of img resampled to width x height. Unlike Resize it
+// changes the aspect ratio as asked and also enlarges.
+func (img *Image) Scale(width, height int) *Image {
+	dst := NewImage(width, height)
+	img.ScaleInto(dst)
+	return dst
+}
+
+// ScaleInto resamples img to the size of dst. Each axis is filtered with a
+// triangle kernel that widens with the reduction when shrinking, so every
+// source pixel contributes and fine detail averages out rather than
+// aliasing. Enlarging interpolates linearly.
+func (img *Image) ScaleInto(dst *Image) {
+	if dst.Width == img.Width && dst.Height == img.Height {
+		copy(dst.Data, img.Data)
+		return
+	}
+	columns := scaleTaps(img.Width, dst.Width)
+	rows := scaleTaps(img.Height, dst.Height)
+
+	// Scale each row horizontally, then the columns of the result
+	stride := dst.Width * 3
+	tmp := make([]float64, img.Height*stride)
+	for y := 0; y < img.Height; y++ {
+		src := img.Data[y*img.Width*3 : (y+1)*img.Width*3]
+		out := tmp[y*stride : (y+1)*stride]
+		for x, t := range columns {
+			var r, g, b float64
+			for i, idx := range t.index {
+				w := t.weight[i]
+				r += w * float64(src[idx*3])
+				g += w * float64(src[idx*3+1])
+				b += w * float64(src[idx*3+2])
+			}
+			out[x*3], out[x*3+1], out[x*3+2] = r, g, b
+		}
+	}
+	for y, t := range rows {
+		out := dst.Data[y*stride : (y+1)*stride]
+		for x := range out {
+			var v float64
+			for i, idx := range t.index {
+				v += t.weight[i] * tmp[idx*stride+x]
+			}
+			out[x] = uint8(math.Max(0, math.Min(255, math.Round(v))))
+		}
+	}
+}
+
+// taps are the source samples and normalized weights of one output sample.
+type taps struct {
+	index  []int
+	weight []float64
+}
+
+// scaleTaps returns the taps of each of the to samples resampled from from
+// samples. Taps past the edges repeat the edge sample.
+func scaleTaps(from, to int) []taps {
+	scale := float64(from) / float64(to)
+	support := math.Max(1, scale)
+	result := make([]taps, to)
+	for i := range result {
+		center := (float64(i)+0.5)*scale - 0.5
+		var t taps
+		var sum float64
+		for j := int(math.Floor(center - support)); j <= int(math.Ceil(center+support)); j++ {
+			w := 1 - math.Abs(float64(j)-center)/support
+			if w <= 0 {
+				continue
+			}
+			idx := j
+			if idx < 0 {
+				idx = 0
+			} else if idx >= from {
+				idx = from - 1
+			}
+			t.index = append(t.index, idx)
+			t.weight = append(t.weight, w)
+			sum += w
+		}
+		for k := range t.weight {
+			t.weight[k] /= sum
+		}
+		result[i] = t
+	}
+	return result
+}
@@ -0,0 +1,160 @@
+// Package interop converts presets between NtscConfig and the preset files of
+// ntscQT and ntsc-rs. Parameters without an equivalent, and conversions that
+// are only approximate, are reported as warnings rather than dropped
+// silently.
+package interop
+
+import (
+	"encoding/json"
+	"fmt"
+	"ntsc-wasm/pkg/ntsc"
+	"reflect"
+	"strings"
+)
+
+// Format identifies a foreign preset format.
+type Format string
+
+const (
+	// FormatNtscQT is the JSON written by ntscQT's "save template": its Ntsc
+	// attributes, such as _video_noise, with their raw values.
+	FormatNtscQT Format = "ntscqt"
+	// FormatNtscRS is the JSON settings format of ntsc-rs, version 1.
+	FormatNtscRS Format = "ntsc-rs"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatNtscQT, FormatNtscRS}
+
+// ParseFormat accepts a format name such as "ntscqt" or "ntsc-rs".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "ntscqt", "ntsc-qt", "qt":
+		return FormatNtscQT, nil
+	case "ntsc-rs", "ntscrs", "rs":
+		return FormatNtscRS, nil
+	default:
+		return "", fmt.Errorf("interop: unknown format %q", name)
+	}
+}
+
+// Warning reports a parameter that could not be converted exactly.
+type Warning struct {
+	Param   string
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Param + ": " + w.Message
+}
+
+type warnings []Warning
+
+func (ws *warnings) add(param, format string, args ...interface{}) {
+	*ws = append(*ws, Warning{param, fmt.Sprintf(format, args...)})
+}
+
+// DetectFormat guesses the format of a preset file: ntsc-rs settings carry a
+// "version" key, ntscQT attributes start with an underscore.
+func DetectFormat(data []byte) (Format, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("interop: invalid preset: %v", err)
+	}
+	if _, ok := doc["version"]; ok {
+		return FormatNtscRS, nil
+	}
+	for key := range doc {
+		if strings.HasPrefix(key, "_") {
+			return FormatNtscQT, nil
+		}
+	}
+	return "", fmt.Errorf("interop: unrecognized preset format")
+}
+
+// Import converts a preset file into a config. Parameters the file omits keep
+// their default values.
+func Import(format Format, data []byte) (*ntsc.NtscConfig, []Warning, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("interop: invalid %s preset: %v", format, err)
+	}
+
+	config := ntsc.DefaultNtscConfig()
+	var ws warnings
+	var err error
+	switch format {
+	case FormatNtscQT:
+		err = importNtscQT(doc, config, &ws)
+	case FormatNtscRS:
+		err = importNtscRS(doc, config, &ws)
+	default:
+		return nil, nil, fmt.Errorf("interop: unknown format %q", format)
+	}
+	if err != nil {
+		return nil, ws, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, ws, err
+	}
+	return config, ws, nil
+}
+
+// Export converts config into a preset file of the given format.
+func Export(format Format, config *ntsc.NtscConfig) ([]byte, []Warning, error) {
+	var doc map[string]interface{}
+	var covered map[string]bool
+	var ws warnings
+	switch format {
+	case FormatNtscQT:
+		doc, covered = exportNtscQT(config, &ws)
+	case FormatNtscRS:
+		doc, covered = exportNtscRS(config, &ws)
+	default:
+		return nil, nil, fmt.Errorf("interop: unknown format %q", format)
+	}
+	warnUncovered(config, covered, format, &ws)
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, ws, fmt.Errorf("interop: %v", err)
+	}
+	return data, ws, nil
+}
+
+// warnUncovered reports every config field outside covered that differs from
+// its default, since the exported preset loses it.
+func warnUncovered(config *ntsc.NtscConfig, covered map[string]bool, format Format, ws *warnings) {
+	value := reflect.ValueOf(config).Elem()
+	defaults := reflect.ValueOf(ntsc.DefaultNtscConfig()).Elem()
+	for _, p := range ntsc.Params() {
+		if covered[p.Name] {
+			continue
+		}
+		v := value.FieldByName(p.Name).Interface()
+		if !reflect.DeepEqual(v, defaults.FieldByName(p.Name).Interface()) {
+			ws.add(p.Name, "no %s equivalent, value %v is not exported", format, v)
+		}
+	}
+}
+
+func decodeNumber(raw json.RawMessage) (float64, error) {
+	var v float64
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+func decodeBool(raw json.RawMessage) (bool, error) {
+	var v bool
+	if err := json.Unmarshal(raw, &v); err != nil {
+		// Some writers store flags as 0 or 1
+		n, nerr := decodeNumber(raw)
+		if nerr != nil {
+			return false, err
+		}
+		return n != 0, nil
+	}
+	return v, nil
+}
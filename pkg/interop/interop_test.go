@@ -0,0 +1,153 @@
+package interop
+
+import (
+	"ntsc-wasm/pkg/ntsc"
+	"testing"
+)
+
+func hasWarning(ws []Warning, param string) bool {
+	for _, w := range ws {
+		if w.Param == param {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNtscQTRoundTrip(t *testing.T) {
+	want := ntsc.DefaultNtscConfig()
+	want.EmulatingVHS = true
+	want.VHSEdgeWave = 3
+	want.Ringing = 0.6
+	want.OutputVHSTapeSpeed = ntsc.VHS_EP
+	want.VideoChromaLoss = 120
+
+	data, ws, err := Export(FormatNtscQT, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ws) != 0 {
+		t.Errorf("unexpected warnings: %v", ws)
+	}
+	if format, err := DetectFormat(data); err != nil || format != FormatNtscQT {
+		t.Errorf("detected %q, %v", format, err)
+	}
+
+	got, ws, err := Import(FormatNtscQT, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ws) != 0 {
+		t.Errorf("unexpected warnings: %v", ws)
+	}
+	if *got != *want {
+		t.Errorf("round trip gave\n%+v\nwant\n%+v", *got, *want)
+	}
+}
+
+func TestNtscQTImport(t *testing.T) {
+	config, ws, err := Import(FormatNtscQT, []byte(`{
+		"_video_noise": 40.0,
+		"_vhs_head_switching": 1,
+		"_output_vhs_tape_speed": 1,
+		"_ringing_power": 3.4,
+		"_brightness": 10
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.VideoNoise != 40 || !config.VHSHeadSwitching || config.OutputVHSTapeSpeed != ntsc.VHS_LP || config.RingingPower != 3 {
+		t.Errorf("imported %+v", config)
+	}
+	if !hasWarning(ws, "_brightness") || !hasWarning(ws, "_ringing_power") {
+		t.Errorf("warnings %v, want _brightness and _ringing_power", ws)
+	}
+
+	if _, _, err := Import(FormatNtscQT, []byte(`{"_output_vhs_tape_speed": 7}`)); err == nil {
+		t.Error("expected an error for an unknown tape speed")
+	}
+	if _, _, err := Import(FormatNtscQT, []byte(`{"_video_noise": 1e9}`)); err == nil {
+		t.Error("expected a validation error")
+	}
+}
+
+func TestNtscRSImport(t *testing.T) {
+	config, ws, err := Import(FormatNtscRS, []byte(`{
+		"version": 1,
+		"random_seed": -1,
+		"video_scanline_phase_shift": 1,
+		"chroma_lowpass_out": 2,
+		"composite_noise": true,
+		"composite_noise_intensity": 0.1,
+		"chroma_noise": false,
+		"chroma_noise_intensity": 0.5,
+		"chroma_delay_horizontal": -2.4,
+		"ringing": true,
+		"ringing_power": 4,
+		"vhs_settings": true,
+		"vhs_tape_speed": 3,
+		"vhs_chroma_loss": 0.0005,
+		"vhs_sharpen": true,
+		"vhs_sharpen_intensity": 0.8,
+		"snow": true
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ntsc.DefaultNtscConfig()
+	want.RandomSeed = 0xffffffff
+	want.ColorBleedHoriz = -2
+	want.VideoScanlinePhaseShift = 90
+	want.CompositeOutChromaLowpassLite = false
+	want.VideoNoise = 26
+	want.Ringing = ntscRSRingingLevel
+	want.EnableRinging2 = true
+	want.RingingPower = 4
+	want.EmulatingVHS = true
+	want.OutputVHSTapeSpeed = ntsc.VHS_EP
+	want.VideoChromaLoss = 50
+	want.VHSOutSharpen = 0.8
+	if *config != *want {
+		t.Errorf("imported\n%+v\nwant\n%+v", *config, *want)
+	}
+	for _, param := range []string{"snow", "composite_noise_intensity", "chroma_delay_horizontal"} {
+		if !hasWarning(ws, param) {
+			t.Errorf("no warning for %s in %v", param, ws)
+		}
+	}
+	if hasWarning(ws, "chroma_noise_intensity") {
+		t.Errorf("warned about disabled chroma noise: %v", ws)
+	}
+}
+
+func TestNtscRSExport(t *testing.T) {
+	config := ntsc.DefaultNtscConfig()
+	config.VideoNoise = 0
+	config.EmulatingVHS = true
+	config.OutputVHSTapeSpeed = ntsc.VHS_LP
+	config.SubcarrierAmplitude = 80
+
+	data, ws, err := Export(FormatNtscRS, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasWarning(ws, "SubcarrierAmplitude") || len(ws) != 1 {
+		t.Errorf("warnings %v, want only SubcarrierAmplitude", ws)
+	}
+	if format, err := DetectFormat(data); err != nil || format != FormatNtscRS {
+		t.Errorf("detected %q, %v", format, err)
+	}
+
+	got, ws, err := Import(FormatNtscRS, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ws) != 0 {
+		t.Errorf("unexpected warnings on import: %v", ws)
+	}
+	config.SubcarrierAmplitude = 50
+	if *got != *config {
+		t.Errorf("round trip gave\n%+v\nwant\n%+v", *got, *config)
+	}
+}
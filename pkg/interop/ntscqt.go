@@ -0,0 +1,163 @@
+package interop
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"ntsc-wasm/pkg/ntsc"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ntscQTFields maps ntscQT's Ntsc attributes, without the leading
+// underscore, to config fields. Both use the same units.
+var ntscQTFields = map[string]string{
+	"composite_preemphasis":             "CompositePreemphasis",
+	"composite_preemphasis_cut":         "CompositePreemphasisCut",
+	"vhs_out_sharpen":                   "VHSOutSharpen",
+	"vhs_edge_wave":                     "VHSEdgeWave",
+	"vhs_head_switching":                "VHSHeadSwitching",
+	"vhs_head_switching_point":          "VHSHeadSwitchingPoint",
+	"vhs_head_switching_phase":          "VHSHeadSwitchingPhase",
+	"vhs_head_switching_phase_noise":    "VHSHeadSwitchingPhaseNoise",
+	"color_bleed_before":                "ColorBleedBefore",
+	"color_bleed_horiz":                 "ColorBleedHoriz",
+	"color_bleed_vert":                  "ColorBleedVert",
+	"ringing":                           "Ringing",
+	"enable_ringing2":                   "EnableRinging2",
+	"ringing_power":                     "RingingPower",
+	"ringing_shift":                     "RingingShift",
+	"freq_noise_size":                   "FreqNoiseSize",
+	"freq_noise_amplitude":              "FreqNoiseAmplitude",
+	"composite_in_chroma_lowpass":       "CompositeInChromaLowpass",
+	"composite_out_chroma_lowpass":      "CompositeOutChromaLowpass",
+	"composite_out_chroma_lowpass_lite": "CompositeOutChromaLowpassLite",
+	"video_chroma_noise":                "VideoChromaNoise",
+	"video_chroma_phase_noise":          "VideoChromaPhaseNoise",
+	"video_chroma_loss":                 "VideoChromaLoss",
+	"video_noise":                       "VideoNoise",
+	"subcarrier_amplitude":              "SubcarrierAmplitude",
+	"subcarrier_amplitude_back":         "SubcarrierAmplitudeBack",
+	"emulating_vhs":                     "EmulatingVHS",
+	"nocolor_subcarrier":                "NoColorSubcarrier",
+	"vhs_chroma_vert_blend":             "VHSChromaVertBlend",
+	"vhs_svideo_out":                    "VHSSVideoOut",
+	"output_ntsc":                       "OutputNTSC",
+	"video_scanline_phase_shift":        "VideoScanlinePhaseShift",
+	"video_scanline_phase_shift_offset": "VideoScanlinePhaseShiftOffset",
+	"output_vhs_tape_speed":             "OutputVHSTapeSpeed",
+	"black_line_cut":                    "BlackLineCut",
+}
+
+// ntscQTTapeSpeeds is ntscQT's VHSSpeed enum in order; presets store the
+// index.
+var ntscQTTapeSpeeds = []ntsc.VHSSpeed{ntsc.VHS_SP, ntsc.VHS_LP, ntsc.VHS_EP}
+
+func importNtscQT(doc map[string]json.RawMessage, config *ntsc.NtscConfig, ws *warnings) error {
+	value := reflect.ValueOf(config).Elem()
+	for _, key := range sortedKeys(doc) {
+		raw := doc[key]
+		name, ok := ntscQTFields[strings.TrimPrefix(key, "_")]
+		if !ok {
+			ws.add(key, "no equivalent, ignored")
+			continue
+		}
+		if name == "OutputVHSTapeSpeed" {
+			speed, err := ntscQTTapeSpeed(raw)
+			if err != nil {
+				return fmt.Errorf("interop: %s: %v", key, err)
+			}
+			config.OutputVHSTapeSpeed = speed
+			continue
+		}
+		if err := setField(value.FieldByName(name), raw, key, ws); err != nil {
+			return fmt.Errorf("interop: %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// ntscQTTapeSpeed accepts the enum index ntscQT stores, or a name such as
+// "VHS_LP" or "LP".
+func ntscQTTapeSpeed(raw json.RawMessage) (ntsc.VHSSpeed, error) {
+	if n, err := decodeNumber(raw); err == nil {
+		if n != math.Trunc(n) || n < 0 || int(n) >= len(ntscQTTapeSpeeds) {
+			return ntsc.VHSSpeed{}, fmt.Errorf("unknown tape speed %v", n)
+		}
+		return ntscQTTapeSpeeds[int(n)], nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return ntsc.VHSSpeed{}, err
+	}
+	var speed ntsc.VHSSpeed
+	quoted, _ := json.Marshal(strings.TrimPrefix(strings.ToUpper(name), "VHS_"))
+	err := json.Unmarshal(quoted, &speed)
+	return speed, err
+}
+
+// setField decodes raw into the bool, int or float field v, rounding
+// fractional values for int fields.
+func setField(v reflect.Value, raw json.RawMessage, key string, ws *warnings) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := decodeBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := decodeNumber(raw)
+		if err != nil {
+			return err
+		}
+		if n != math.Round(n) {
+			ws.add(key, "rounded %v to %v", n, math.Round(n))
+		}
+		v.SetInt(int64(math.Round(n)))
+	case reflect.Float64:
+		n, err := decodeNumber(raw)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+func exportNtscQT(config *ntsc.NtscConfig, ws *warnings) (map[string]interface{}, map[string]bool) {
+	value := reflect.ValueOf(config).Elem()
+	doc := map[string]interface{}{}
+	covered := map[string]bool{}
+	for key, name := range ntscQTFields {
+		covered[name] = true
+		if name == "OutputVHSTapeSpeed" {
+			index := -1
+			for i, speed := range ntscQTTapeSpeeds {
+				if config.OutputVHSTapeSpeed == speed {
+					index = i
+				}
+			}
+			if index < 0 {
+				ws.add(name, "custom tape speed %+v has no ntscQT equivalent, exported as SP", config.OutputVHSTapeSpeed)
+				index = 0
+			}
+			doc["_"+key] = index
+			continue
+		}
+		doc["_"+key] = value.FieldByName(name).Interface()
+	}
+	return doc, covered
+}
+
+func sortedKeys(doc map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
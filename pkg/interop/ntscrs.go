@@ -0,0 +1,303 @@
+package interop
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"ntsc-wasm/pkg/ntsc"
+)
+
+// ntsc-rs models several effects differently. Noise intensities are
+// fractions of the signal range where ours are 8-bit YIQ units, and phase
+// noise is in turns where ours is in hundredths of pi radians. These scales
+// convert between them; the result looks alike but is not identical.
+const (
+	ntscRSVersion      = 1
+	ntscRSNoiseScale   = 255.0
+	ntscRSPhaseScale   = 200.0
+	ntscRSChromaLoss   = 100000.0
+	ntscRSRingingLevel = 0.5
+)
+
+// ntsc-rs ChromaLowpass values.
+const (
+	ntscRSLowpassNone = iota
+	ntscRSLowpassLight
+	ntscRSLowpassFull
+)
+
+// ntscRSTapeSpeeds is indexed by ntsc-rs VHSTapeSpeed, where 0 means none.
+var ntscRSTapeSpeeds = []ntsc.VHSSpeed{{}, ntsc.VHS_SP, ntsc.VHS_LP, ntsc.VHS_EP}
+
+// ntscRSFields lists the config fields an ntsc-rs preset carries.
+var ntscRSFields = []string{
+	"RandomSeed", "VideoScanlinePhaseShift", "VideoScanlinePhaseShiftOffset",
+	"CompositePreemphasis", "CompositeInChromaLowpass", "CompositeOutChromaLowpass",
+	"CompositeOutChromaLowpassLite", "VideoNoise", "VideoChromaNoise",
+	"VideoChromaPhaseNoise", "ColorBleedHoriz", "ColorBleedVert", "VHSHeadSwitching",
+	"Ringing", "EnableRinging2", "RingingPower", "EmulatingVHS", "OutputVHSTapeSpeed",
+	"VideoChromaLoss", "VHSOutSharpen", "VHSEdgeWave", "VHSChromaVertBlend",
+}
+
+// rsReader reads settings from an ntsc-rs document and remembers which keys
+// were used, so the rest can be reported.
+type rsReader struct {
+	doc  map[string]json.RawMessage
+	used map[string]bool
+	err  error
+}
+
+func (r *rsReader) number(key string) (float64, bool) {
+	raw, ok := r.doc[key]
+	if !ok || r.err != nil {
+		return 0, false
+	}
+	r.used[key] = true
+	n, err := decodeNumber(raw)
+	if err != nil {
+		r.err = fmt.Errorf("interop: %s: %v", key, err)
+		return 0, false
+	}
+	return n, true
+}
+
+func (r *rsReader) flag(key string) (bool, bool) {
+	raw, ok := r.doc[key]
+	if !ok || r.err != nil {
+		return false, false
+	}
+	r.used[key] = true
+	b, err := decodeBool(raw)
+	if err != nil {
+		r.err = fmt.Errorf("interop: %s: %v", key, err)
+		return false, false
+	}
+	return b, true
+}
+
+// section reads an effect that ntsc-rs enables with a flag and sizes with an
+// intensity. A missing flag counts as enabled if the intensity is present.
+func (r *rsReader) section(enable, intensity string) (float64, bool) {
+	n, hasValue := r.number(intensity)
+	on, hasFlag := r.flag(enable)
+	if hasFlag && !on {
+		return 0, true
+	}
+	return n, hasValue
+}
+
+func importNtscRS(doc map[string]json.RawMessage, config *ntsc.NtscConfig, ws *warnings) error {
+	r := &rsReader{doc: doc, used: map[string]bool{}}
+
+	if v, ok := r.number("version"); ok && v != ntscRSVersion {
+		ws.add("version", "settings version %v is read as version %d", v, ntscRSVersion)
+	}
+	if v, ok := r.number("random_seed"); ok {
+		config.RandomSeed = uint32(int32(v))
+	}
+	if v, ok := r.number("video_scanline_phase_shift"); ok {
+		switch {
+		case v >= 0 && v <= 3 && v == math.Trunc(v):
+			config.VideoScanlinePhaseShift = int(v) * 90
+		default:
+			// Accept degrees as well as the enum index
+			config.VideoScanlinePhaseShift = int(v)
+		}
+	}
+	if v, ok := r.number("video_scanline_phase_shift_offset"); ok {
+		config.VideoScanlinePhaseShiftOffset = int(math.Round(v))
+	}
+	if v, ok := r.number("composite_preemphasis"); ok {
+		config.CompositePreemphasis = v
+		if v != 0 {
+			ws.add("composite_preemphasis", "filter differs from ntsc-rs, strength %v is approximate", v)
+		}
+	}
+	if v, ok := r.number("chroma_lowpass_in"); ok {
+		config.CompositeInChromaLowpass = v != ntscRSLowpassNone
+	}
+	if v, ok := r.number("chroma_lowpass_out"); ok {
+		config.CompositeOutChromaLowpass = v != ntscRSLowpassNone
+		config.CompositeOutChromaLowpassLite = v == ntscRSLowpassLight
+	}
+	if v, ok := r.section("composite_noise", "composite_noise_intensity"); ok {
+		config.VideoNoise = int(math.Round(v * ntscRSNoiseScale))
+		if v != 0 {
+			ws.add("composite_noise_intensity", "converted approximately to VideoNoise %d", config.VideoNoise)
+		}
+	}
+	if v, ok := r.section("chroma_noise", "chroma_noise_intensity"); ok {
+		config.VideoChromaNoise = int(math.Round(v * ntscRSNoiseScale))
+		if v != 0 {
+			ws.add("chroma_noise_intensity", "converted approximately to VideoChromaNoise %d", config.VideoChromaNoise)
+		}
+	}
+	if v, ok := r.number("chroma_phase_noise_intensity"); ok {
+		config.VideoChromaPhaseNoise = int(math.Round(v * ntscRSPhaseScale))
+		if v != 0 {
+			ws.add("chroma_phase_noise_intensity", "converted approximately to VideoChromaPhaseNoise %d", config.VideoChromaPhaseNoise)
+		}
+	}
+	if v, ok := r.number("chroma_delay_horizontal"); ok {
+		config.ColorBleedHoriz = delay("chroma_delay_horizontal", v, ws)
+	}
+	if v, ok := r.number("chroma_delay_vertical"); ok {
+		config.ColorBleedVert = delay("chroma_delay_vertical", v, ws)
+	}
+	if v, ok := r.flag("head_switching"); ok {
+		config.VHSHeadSwitching = v
+	}
+	if on, ok := r.flag("ringing"); ok {
+		config.Ringing = 1
+		if on {
+			// Any level other than 1 enables the stage; EnableRinging2
+			// selects the filter closest to ntsc-rs
+			config.Ringing = ntscRSRingingLevel
+			config.EnableRinging2 = true
+		}
+	}
+	if v, ok := r.number("ringing_power"); ok {
+		power := int(math.Round(math.Max(1, math.Min(10, v))))
+		if float64(power) != v {
+			ws.add("ringing_power", "converted %v to RingingPower %d", v, power)
+		}
+		config.RingingPower = power
+	}
+	if v, ok := r.flag("vhs_settings"); ok {
+		config.EmulatingVHS = v
+	}
+	if v, ok := r.number("vhs_tape_speed"); ok {
+		i := int(v)
+		switch {
+		case float64(i) != v || i < 0 || i >= len(ntscRSTapeSpeeds):
+			return fmt.Errorf("interop: vhs_tape_speed: unknown tape speed %v", v)
+		case i == 0:
+			ws.add("vhs_tape_speed", "no tape speed, kept %s", tapeSpeedName(config.OutputVHSTapeSpeed))
+		default:
+			config.OutputVHSTapeSpeed = ntscRSTapeSpeeds[i]
+		}
+	}
+	if v, ok := r.number("vhs_chroma_loss"); ok {
+		config.VideoChromaLoss = int(math.Round(v * ntscRSChromaLoss))
+	}
+	if v, ok := r.section("vhs_sharpen", "vhs_sharpen_intensity"); ok {
+		config.VHSOutSharpen = v
+	}
+	if v, ok := r.section("vhs_edge_wave", "vhs_edge_wave_intensity"); ok {
+		config.VHSEdgeWave = int(math.Round(v))
+		if float64(config.VHSEdgeWave) != v {
+			ws.add("vhs_edge_wave_intensity", "rounded %v to VHSEdgeWave %d", v, config.VHSEdgeWave)
+		}
+	}
+	if v, ok := r.flag("vhs_chroma_vert_blend"); ok {
+		config.VHSChromaVertBlend = v
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	for _, key := range sortedKeys(doc) {
+		if !r.used[key] {
+			ws.add(key, "no equivalent, ignored")
+		}
+	}
+	return nil
+}
+
+// delay converts an ntsc-rs chroma delay to a color bleed, rounding it to
+// whole pixels and lines.
+func delay(key string, v float64, ws *warnings) int {
+	n := int(math.Round(v))
+	if float64(n) != v {
+		ws.add(key, "rounded %v to %d", v, n)
+	}
+	return n
+}
+
+func tapeSpeedName(speed ntsc.VHSSpeed) string {
+	data, _ := json.Marshal(speed)
+	var name string
+	if json.Unmarshal(data, &name) != nil {
+		return "custom"
+	}
+	return name
+}
+
+func exportNtscRS(config *ntsc.NtscConfig, ws *warnings) (map[string]interface{}, map[string]bool) {
+	lowpassOut := ntscRSLowpassNone
+	if config.CompositeOutChromaLowpass {
+		lowpassOut = ntscRSLowpassFull
+		if config.CompositeOutChromaLowpassLite {
+			lowpassOut = ntscRSLowpassLight
+		}
+	}
+	lowpassIn := ntscRSLowpassNone
+	if config.CompositeInChromaLowpass {
+		lowpassIn = ntscRSLowpassFull
+	}
+
+	tapeSpeed := 0
+	for i, speed := range ntscRSTapeSpeeds[1:] {
+		if config.OutputVHSTapeSpeed == speed {
+			tapeSpeed = i + 1
+		}
+	}
+	if tapeSpeed == 0 {
+		ws.add("OutputVHSTapeSpeed", "custom tape speed %+v has no ntsc-rs equivalent, exported as SP", config.OutputVHSTapeSpeed)
+		tapeSpeed = 1
+	}
+
+	ringing := config.Ringing != 1
+	if ringing && !config.EnableRinging2 {
+		ws.add("Ringing", "ntsc-rs has no edge ringing, level %v exported as its frequency domain ringing", config.Ringing)
+	}
+	if config.CompositePreemphasis != 0 {
+		ws.add("CompositePreemphasis", "filter differs from ntsc-rs, strength %v is approximate", config.CompositePreemphasis)
+	}
+	for _, noise := range []struct {
+		name  string
+		value int
+	}{
+		{"VideoNoise", config.VideoNoise},
+		{"VideoChromaNoise", config.VideoChromaNoise},
+		{"VideoChromaPhaseNoise", config.VideoChromaPhaseNoise},
+	} {
+		if noise.value != 0 {
+			ws.add(noise.name, "value %d converted approximately", noise.value)
+		}
+	}
+
+	doc := map[string]interface{}{
+		"version":                           ntscRSVersion,
+		"random_seed":                       int32(config.RandomSeed),
+		"video_scanline_phase_shift":        config.VideoScanlinePhaseShift / 90,
+		"video_scanline_phase_shift_offset": config.VideoScanlinePhaseShiftOffset,
+		"composite_preemphasis":             config.CompositePreemphasis,
+		"chroma_lowpass_in":                 lowpassIn,
+		"chroma_lowpass_out":                lowpassOut,
+		"composite_noise":                   config.VideoNoise != 0,
+		"composite_noise_intensity":         float64(config.VideoNoise) / ntscRSNoiseScale,
+		"chroma_noise":                      config.VideoChromaNoise != 0,
+		"chroma_noise_intensity":            float64(config.VideoChromaNoise) / ntscRSNoiseScale,
+		"chroma_phase_noise_intensity":      float64(config.VideoChromaPhaseNoise) / ntscRSPhaseScale,
+		"chroma_delay_horizontal":           config.ColorBleedHoriz,
+		"chroma_delay_vertical":             config.ColorBleedVert,
+		"head_switching":                    config.VHSHeadSwitching,
+		"ringing":                           ringing,
+		"ringing_power":                     config.RingingPower,
+		"vhs_settings":                      config.EmulatingVHS,
+		"vhs_tape_speed":                    tapeSpeed,
+		"vhs_chroma_loss":                   float64(config.VideoChromaLoss) / ntscRSChromaLoss,
+		"vhs_sharpen":                       config.VHSOutSharpen != 0,
+		"vhs_sharpen_intensity":             config.VHSOutSharpen,
+		"vhs_edge_wave":                     config.VHSEdgeWave != 0,
+		"vhs_edge_wave_intensity":           config.VHSEdgeWave,
+		"vhs_chroma_vert_blend":             config.VHSChromaVertBlend,
+	}
+
+	covered := map[string]bool{}
+	for _, name := range ntscRSFields {
+		covered[name] = true
+	}
+	return doc, covered
+}
@@ -0,0 +1,139 @@
+package ntsc
+
+import (
+	"context"
+	"ntsc-wasm/pkg/image"
+	"testing"
+)
+
+// benchSizes are the frame sizes every benchmark runs at. Select one with,
+// for example, -bench 'Stage/ringing2/SD'.
+var benchSizes = []struct {
+	name          string
+	width, height int
+}{
+	{"SD", 720, 480},
+	{"HD", 1920, 1080},
+	{"4K", 3840, 2160},
+}
+
+// benchConfig enables every effect, so each stage does its full work.
+func benchConfig() *NtscConfig {
+	c := DefaultNtscConfig()
+	c.CompositePreemphasis = 4
+	c.VHSEdgeWave = 4
+	c.VHSHeadSwitching = true
+	c.HeadSwitchingSpeed = 50
+	c.ColorBleedHoriz = 5
+	c.ColorBleedVert = 3
+	c.Ringing = 0.5
+	c.RingingPower = 4
+	c.RingingShift = 1
+	c.VideoChromaNoise = 2000
+	c.VideoChromaPhaseNoise = 20
+	c.VideoChromaLoss = 50000
+	c.VideoNoise = 100
+	c.EmulatingVHS = true
+	return c
+}
+
+func newYIQ(width, height int) *YIQImage {
+	return &YIQImage{Data: make([]int32, width*height*3), Width: width, Height: height}
+}
+
+// benchStage is a step timed by BenchmarkStage. It works on field 0 of f.
+// configure, if set, adjusts benchConfig for it.
+type benchStage struct {
+	name      string
+	apply     func(f *Field)
+	configure func(c *NtscConfig)
+}
+
+func benchStages() []benchStage {
+	var stages []benchStage
+	for _, stage := range DefaultPipeline() {
+		stages = append(stages, benchStage{name: stage.Name(), apply: stage.Apply})
+	}
+	vhsSpeed := VHS_SP
+	return append(stages,
+		benchStage{name: "ringing2", apply: func(f *Field) {
+			f.processor.ringing(f.YIQ, f.Field)
+		}, configure: func(c *NtscConfig) {
+			c.EnableRinging2 = true
+		}},
+		benchStage{name: "vhsLumaLowpass", apply: func(f *Field) {
+			f.processor.vhsLumaLowpass(f.YIQ, f.Field, vhsSpeed.LumaCut)
+		}},
+		benchStage{name: "vhsChromaLowpass", apply: func(f *Field) {
+			f.processor.vhsChromaLowpass(f.YIQ, f.Field, vhsSpeed.ChromaCut, vhsSpeed.ChromaDelay)
+		}},
+		benchStage{name: "vhsSharpen", apply: func(f *Field) {
+			f.processor.vhsSharpen(f.YIQ, f.Field, vhsSpeed.LumaCut)
+		}},
+		benchStage{name: "vhsEdgeWave", apply: func(f *Field) {
+			f.processor.vhsEdgeWave(f.YIQ, f.Random("vhsEdgeWave"), f.Field)
+		}},
+	)
+}
+
+// BenchmarkStage times each stage on its own. The YIQ planes are restored
+// from the converted test image before every iteration, outside the timer.
+func BenchmarkStage(b *testing.B) {
+	for _, stage := range benchStages() {
+		for _, size := range benchSizes {
+			stage, size := stage, size
+			b.Run(stage.name+"/"+size.name, func(b *testing.B) {
+				config := benchConfig()
+				if stage.configure != nil {
+					stage.configure(config)
+				}
+				p := newProcessor(b, config)
+				src := newYIQ(size.width, size.height)
+				if err := p.bgr2yiq(context.Background(), testImage(size.width, size.height), src); err != nil {
+					b.Fatal(err)
+				}
+				yiq := newYIQ(size.width, size.height)
+				f := &Field{YIQ: yiq, Config: p.Config, processor: p, state: &p.fields[0]}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					copy(yiq.Data, src.Data)
+					b.StartTimer()
+					stage.apply(f)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkConvert times the conversions to and from YIQ around the
+// pipeline.
+func BenchmarkConvert(b *testing.B) {
+	for _, size := range benchSizes {
+		size := size
+		p := newProcessor(b, benchConfig())
+		img := testImage(size.width, size.height)
+		yiq := newYIQ(size.width, size.height)
+
+		b.Run("bgr2yiq/"+size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(img.Data)))
+			for i := 0; i < b.N; i++ {
+				if err := p.bgr2yiq(context.Background(), img, yiq); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("yiq2bgr/"+size.name, func(b *testing.B) {
+			dst := image.NewImage(size.width, size.height)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(img.Data)))
+			for i := 0; i < b.N; i++ {
+				p.yiq2bgr(yiq, dst, 0)
+				p.yiq2bgr(yiq, dst, 1)
+			}
+		})
+	}
+}
@@ -20,9 +20,11 @@ func bitReverseCopy(x []complex128) []complex128 {
 
 func fft(x []complex128) []complex128 {
 	N := len(x)
-	if N == 0 || (N&(N-1)) != 0 { // Check if N is a power of 2
-		// Handle non-power-of-2 sizes if necessary, or return error
-		return nil // For simplicity, returning nil for now
+	if N == 0 {
+		return nil
+	}
+	if (N & (N - 1)) != 0 { // Check if N is a power of 2
+		return bluestein(x)
 	}
 
 	data := bitReverseCopy(x)
@@ -46,8 +48,20 @@ func fft(x []complex128) []complex128 {
 
 func ifft(x []complex128) []complex128 {
 	N := len(x)
-	if N == 0 || (N&(N-1)) != 0 { // Check if N is a power of 2
-		return nil // For simplicity, returning nil for now
+	if N == 0 {
+		return nil
+	}
+	if (N & (N - 1)) != 0 {
+		// ifft(x) = conj(fft(conj(x))) / N
+		data := make([]complex128, N)
+		for i, v := range x {
+			data[i] = cmplx.Conj(v)
+		}
+		data = bluestein(data)
+		for i, v := range data {
+			data[i] = cmplx.Conj(v) / complex(float64(N), 0)
+		}
+		return data
 	}
 
 	data := bitReverseCopy(x)
@@ -73,24 +87,62 @@ func ifft(x []complex128) []complex128 {
 	return data
 }
 
-func fftShift(x []complex128) []complex128 {
+// bluestein computes the DFT of any length as a convolution, which is done
+// with power of two FFTs of at least twice the length.
+func bluestein(x []complex128) []complex128 {
 	N := len(x)
-	result := make([]complex128, N)
+	M := 1
+	for M < 2*N-1 {
+		M <<= 1
+	}
 
-	midpoint := N / 2
+	// Chirp w[k] = exp(-i*pi*k^2/N); k^2 is reduced mod 2N to keep precision
+	w := make([]complex128, N)
+	for k := 0; k < N; k++ {
+		kk := (k * k) % (2 * N)
+		w[k] = cmplx.Exp(complex(0, -math.Pi*float64(kk)/float64(N)))
+	}
 
-	for i := 0; i < midpoint; i++ {
-		result[i] = x[i+midpoint]
+	a := make([]complex128, M)
+	b := make([]complex128, M)
+	for k := 0; k < N; k++ {
+		a[k] = x[k] * w[k]
+	}
+	b[0] = cmplx.Conj(w[0])
+	for k := 1; k < N; k++ {
+		b[k] = cmplx.Conj(w[k])
+		b[M-k] = b[k]
 	}
 
-	for i := 0; i < midpoint; i++ {
-		result[i+midpoint] = x[i]
+	fa, fb := fft(a), fft(b)
+	for i := range fa {
+		fa[i] *= fb[i]
 	}
+	conv := ifft(fa)
 
+	result := make([]complex128, N)
+	for k := 0; k < N; k++ {
+		result[k] = conv[k] * w[k]
+	}
 	return result
 }
 
-func ifftShift(x []complex128) []complex128 {
+// fftShift moves the zero frequency to the center, like numpy.fft.fftshift.
+func fftShift(x []complex128) []complex128 {
+	N := len(x)
+	result := make([]complex128, N)
+	for i := 0; i < N; i++ {
+		result[(i+N/2)%N] = x[i]
+	}
+	return result
+}
 
-	return fftShift(x)
+// ifftShift undoes fftShift, which differs from it for odd lengths.
+func ifftShift(x []complex128) []complex128 {
+	N := len(x)
+	result := make([]complex128, N)
+	for i := 0; i < N; i++ {
+		result[i] = x[(i+N/2)%N]
+	}
+	return result
 }
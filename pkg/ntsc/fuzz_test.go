@@ -0,0 +1,135 @@
+package ntsc
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+)
+
+// maxSample bounds the YIQ values any stage may leave behind. Values beyond
+// it come from NaN or infinite floats converted to int32.
+const maxSample = 1 << 24
+
+// checkedPipeline wraps every stage of the default pipeline so that the YIQ
+// planes are checked for runaway values after it runs.
+func checkedPipeline(t *testing.T) Pipeline {
+	var once sync.Once
+	var pipeline Pipeline
+	for _, stage := range DefaultPipeline() {
+		stage := stage
+		pipeline = append(pipeline, NewStage(stage.Name(), stage.Enabled, func(f *Field) {
+			stage.Apply(f)
+			for i, v := range f.YIQ.Data {
+				if v > maxSample || v < -maxSample {
+					once.Do(func() {
+						t.Errorf("%s left %d at sample %d of field %d", stage.Name(), v, i, f.Field)
+					})
+					return
+				}
+			}
+		}))
+	}
+	return pipeline
+}
+
+// mutateConfig pushes the fields named by the request to the ends of their
+// ranges. Each pair of bytes of ops is an op: the first byte picks the field
+// and the second its value.
+func mutateConfig(c *NtscConfig, ops []byte) {
+	standards := VideoStandards()
+	for i := 0; i+1 < len(ops); i += 2 {
+		v := float64(ops[i+1]) / 255
+		switch ops[i] % 11 {
+		case 0:
+			c.Ringing = v * 10
+		case 1:
+			c.RingingShift = int(v*20) - 10
+		case 2:
+			c.RingingPower = 1 + int(v*9)
+		case 3:
+			c.EnableRinging2 = ops[i+1]%2 == 1
+		case 4:
+			c.VHSEdgeWave = int(v * 100)
+			c.EmulatingVHS = true
+		case 5:
+			c.FreqNoiseSize = v * 10
+			c.FreqNoiseAmplitude = v * 10
+		case 6:
+			c.ColorBleedHoriz = int(v * 100)
+			c.ColorBleedVert = int(v * 100)
+		case 7:
+			c.CompositePreemphasis = v * 16
+		case 8:
+			c.VHSHeadSwitching = true
+			c.HeadSwitchingSpeed = int(v * 1000)
+		case 9:
+			c.VideoNoise = int(v * 10000)
+			c.VideoChromaNoise = int(v * 16384)
+		case 10:
+			c.VideoStandard = standards[int(ops[i+1])%len(standards)].Name
+		}
+	}
+}
+
+func FuzzProcessImage(f *testing.F) {
+	f.Add(uint32(1), uint16(64), uint16(48), []byte{})
+	f.Add(uint32(2), uint16(3), uint16(5), []byte{})
+	f.Add(uint32(3), uint16(4), uint16(2), []byte{3, 1, 0, 128})
+	f.Add(uint32(4), uint16(100), uint16(7), []byte{3, 1, 0, 255, 1, 255})
+	f.Add(uint32(5), uint16(33), uint16(31), []byte{4, 200, 8, 255})
+	f.Add(uint32(6), uint16(17), uint16(9), []byte{0, 0, 5, 255, 7, 255})
+	f.Add(uint32(7), uint16(45), uint16(13), []byte{10, 5, 4, 100, 9, 30})
+	f.Add(uint32(8), uint16(31), uint16(21), []byte{10, 6, 6, 255, 8, 90})
+
+	f.Fuzz(func(t *testing.T, seed uint32, width, height uint16, ops []byte) {
+		width, height = width%300+1, height%200+1
+		config := RandomNtscConfig(seed)
+		mutateConfig(config, ops)
+		if err := config.Validate(); err != nil {
+			t.Fatalf("mutated config is invalid: %v", err)
+		}
+
+		p := newProcessor(t, config)
+		p.Pipeline = checkedPipeline(t)
+		src := testImage(int(width), int(height))
+		out, err := p.ProcessImage(src)
+		if int(width) < MinImageWidth || int(height) < MinImageHeight {
+			if !errors.Is(err, ErrImageTooSmall) {
+				t.Fatalf("%dx%d: got %v, want ErrImageTooSmall", width, height, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer Release(out)
+		if out.Width != src.Width || out.Height != src.Height || len(out.Data) != len(src.Data) {
+			t.Fatalf("%dx%d became %dx%d with %d bytes", src.Width, src.Height, out.Width, out.Height, len(out.Data))
+		}
+	})
+}
+
+func FuzzFFT(f *testing.F) {
+	f.Add(uint16(1))
+	f.Add(uint16(7))
+	f.Add(uint16(64))
+	f.Add(uint16(100))
+
+	f.Fuzz(func(t *testing.T, n uint16) {
+		n = n%1024 + 1
+		x := make([]complex128, n)
+		for i := range x {
+			x[i] = complex(math.Sin(float64(i)*0.7)*100, 0)
+		}
+		y := ifft(fft(x))
+		if len(y) != len(x) {
+			t.Fatalf("round trip of %d samples gave %d", n, len(y))
+		}
+		for i := range x {
+			if d := y[i] - x[i]; math.Abs(real(d)) > 1e-6 || math.Abs(imag(d)) > 1e-6 {
+				t.Fatalf("sample %d of %d: got %v, want %v", i, n, y[i], x[i])
+			}
+		}
+	})
+}
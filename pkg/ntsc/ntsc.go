@@ -1,14 +1,13 @@
 package ntsc
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"math"
 	"ntsc-wasm/pkg/image"
 	"ntsc-wasm/pkg/pool"
 	"ntsc-wasm/pkg/random"
 	"sync"
-	"time"
 )
 
 const (
@@ -16,7 +15,6 @@ const (
 	M_PI          = math.Pi
 	Int_MIN_VALUE = -2147483648
 	Int_MAX_VALUE = 2147483647
-	debugMode     = false
 )
 
 type VHSSpeed struct {
@@ -31,38 +29,6 @@ var (
 	VHS_EP = VHSSpeed{1400000.0, 280000.0, 14}
 )
 
-func (v *VHSSpeed) UnmarshalJSON(data []byte) error {
-	var speedIndex int
-	if err := json.Unmarshal(data, &speedIndex); err != nil {
-		return err
-	}
-
-	switch speedIndex {
-	case 0:
-		*v = VHS_SP
-	case 1:
-		*v = VHS_LP
-	case 2:
-		*v = VHS_EP
-	default:
-		*v = VHS_SP
-	}
-	return nil
-}
-
-func (v VHSSpeed) MarshalJSON() ([]byte, error) {
-	switch v {
-	case VHS_SP:
-		return json.Marshal(0)
-	case VHS_LP:
-		return json.Marshal(1)
-	case VHS_EP:
-		return json.Marshal(2)
-	default:
-		return json.Marshal(0)
-	}
-}
-
 type LowpassFilter struct {
 	timeInterval float64
 	tau          float64
@@ -155,10 +121,15 @@ type NtscConfig struct {
 	VHSChromaVertBlend            bool
 	VHSSVideoOut                  bool
 	OutputNTSC                    bool
+	VideoStandard                 string
+	PALPhaseError                 float64
+	PALDelayLine                  float64
+	EmulatingSetup                bool
 	VideoScanlinePhaseShift       int
 	VideoScanlinePhaseShiftOffset int
 	OutputVHSTapeSpeed            VHSSpeed
 	BlackLineCut                  bool
+	Resample                      bool
 	Precise                       bool
 
 	RandomSeed  uint32
@@ -172,9 +143,9 @@ func DefaultNtscConfig() *NtscConfig {
 		VHSOutSharpen:                 1.5,
 		VHSEdgeWave:                   0,
 		VHSHeadSwitching:              false,
-		VHSHeadSwitchingPoint:         1.0 - (4.5+0.01)/262.5,
-		VHSHeadSwitchingPhase:         (1.0 - 0.01) / 262.5,
-		VHSHeadSwitchingPhaseNoise:    1.0 / 500 / 262.5,
+		VHSHeadSwitchingPoint:         1.0 - (4.5+0.01)/NTSC_M.FieldLines(),
+		VHSHeadSwitchingPhase:         (1.0 - 0.01) / NTSC_M.FieldLines(),
+		VHSHeadSwitchingPhaseNoise:    1.0 / 500 / NTSC_M.FieldLines(),
 		HeadSwitchingSpeed:            0,
 		ColorBleedBefore:              true,
 		ColorBleedHoriz:               0,
@@ -199,10 +170,15 @@ func DefaultNtscConfig() *NtscConfig {
 		VHSChromaVertBlend:            true,
 		VHSSVideoOut:                  false,
 		OutputNTSC:                    true,
+		VideoStandard:                 StandardNTSC,
+		PALPhaseError:                 0,
+		PALDelayLine:                  1,
+		EmulatingSetup:                false,
 		VideoScanlinePhaseShift:       180,
 		VideoScanlinePhaseShiftOffset: 0,
 		OutputVHSTapeSpeed:            VHS_SP,
 		BlackLineCut:                  false,
+		Resample:                      false,
 		Precise:                       false,
 
 		RandomSeed:  12345,
@@ -212,66 +188,327 @@ func DefaultNtscConfig() *NtscConfig {
 
 type YIQImage = pool.YIQImage
 
+// NtscProcessor applies an NtscConfig to images. Calls on a single processor
+// are serialized; use one processor per goroutine to process in parallel.
 type NtscProcessor struct {
-	Config        *NtscConfig
-	Random        *random.XorWowRandom
-	Precise       bool
-	Umult         []int32
-	Vmult         []int32
+	Config *NtscConfig
+	// Precise selects the slower, more accurate noise generators.
+	// NewNtscProcessor takes it from Config.Precise.
+	Precise bool
+	Umult   []int32
+	Vmult   []int32
+	// Pipeline lists the stages applied to each field before conversion
+	// back to RGB. Nil means DefaultPipeline().
+	Pipeline Pipeline
+	// Observer, if set, is told about every stage that runs.
+	Observer Observer
+	// Frame is the index of the image in a video. PAL uses it to place the
+	// fields in its eight-field subcarrier sequence.
+	Frame int
+
+	mu     sync.Mutex
+	fields [2]fieldState
+}
+
+// fieldState holds the scratch buffers owned by one field goroutine, so the
+// two fields never share mutable state.
+type fieldState struct {
 	chromaBuffers *ChromaBuffers
 	samplesBuffer []float64
-	int32Buffer   []int32
-	float64Buffer []float64
+
+	// run and stage are the call and stage in progress, for nextRow. run
+	// is nil outside ProcessIntoContext.
+	run    *processRun
+	stage  string
+	height int
 }
 
-func NewNtscProcessor(config *NtscConfig) *NtscProcessor {
+func (fs *fieldState) chroma(width int) *ChromaBuffers {
+	if fs.chromaBuffers == nil || len(fs.chromaBuffers.chroma) < width {
+		fs.chromaBuffers = newChromaBuffers(width)
+	}
+	return fs.chromaBuffers
+}
+
+func (fs *fieldState) samples(width int) []float64 {
+	if len(fs.samplesBuffer) < width {
+		fs.samplesBuffer = make([]float64, width)
+	}
+	return fs.samplesBuffer[:width]
+}
+
+// NewNtscProcessor returns a processor for config, or the error from
+// config.Validate.
+func NewNtscProcessor(config *NtscConfig) (*NtscProcessor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	p := &NtscProcessor{
 		Config:  config,
-		Random:  random.NewXorWowRandom(31374242),
-		Precise: false,
+		Precise: config.Precise,
 		Umult:   []int32{1, 0, -1, 0},
 		Vmult:   []int32{0, 1, 0, -1},
 	}
-	return p
+	return p, nil
 }
 
-func (p *NtscProcessor) ProcessImage(img *image.Image) *image.Image {
+// fieldRandom returns the random stream for one stage of one field. Streams
+// are derived from RandomSeed and RandomSeed2, so output is reproducible and
+// enabling one effect does not reshuffle the noise of any other effect.
+func (p *NtscProcessor) fieldRandom(fieldno int, stage string) *random.XorWowRandom {
+	seed := uint64(p.Config.RandomSeed)<<32 | uint64(p.Config.RandomSeed2)
+	return random.NewXorWowRandom(random.DeriveSeed(seed, fmt.Sprintf("field%d/%s", fieldno, stage)))
+}
+
+// ProcessImage processes img into a new image taken from
+// pool.DefaultImagePool. The caller owns the result and may hand it back
+// with Release once it is no longer needed; use ProcessInto to supply the
+// destination buffer instead.
+func (p *NtscProcessor) ProcessImage(img *image.Image) (*image.Image, error) {
+	return p.ProcessImageContext(context.Background(), img, nil)
+}
+
+// ProcessInto processes src and writes every pixel of dst, which must have
+// the same dimensions unless Config.Resample is set, in which case the result
+// is scaled to fit dst. dst may be src itself. Both buffers stay owned by the
+// caller, so a video loop can reuse one destination for every frame.
+func (p *NtscProcessor) ProcessInto(dst, src *image.Image) error {
+	return p.ProcessIntoContext(context.Background(), dst, src, nil)
+}
+
+// ProgressFunc is called after each stage that ran, and every rowBand rows
+// of a field within a stage, with the stage name and the fraction of the
+// whole image that is done, in (0, 1]. The fraction only grows. Calls are
+// serialized, but may come from either field goroutine.
+type ProgressFunc func(stage string, done float64)
+
+// ProcessImageContext is like ProcessImage, but stops between stages and
+// row bands once ctx is done, returning ctx.Err(). progress may be nil.
+func (p *NtscProcessor) ProcessImageContext(ctx context.Context, img *image.Image, progress ProgressFunc) (*image.Image, error) {
+	if img == nil {
+		return nil, fmt.Errorf("ntsc: nil image")
+	}
 	dst := pool.DefaultImagePool.Get(img.Width, img.Height)
-	copy(dst.Data, img.Data)
-	yiq := p.bgr2yiq(img)
-	defer pool.DefaultYIQImagePool.Put(yiq)
+	if err := p.ProcessIntoContext(ctx, dst, img, progress); err != nil {
+		Release(dst)
+		return nil, err
+	}
+	return dst, nil
+}
+
+// ProcessIntoContext is like ProcessInto, but stops between stages and row
+// bands once ctx is done, returning ctx.Err(). The contents of dst are
+// undefined after a cancelled call. progress may be nil.
+func (p *NtscProcessor) ProcessIntoContext(ctx context.Context, dst, src *image.Image, progress ProgressFunc) error {
+	if dst == nil || src == nil {
+		return fmt.Errorf("ntsc: nil image")
+	}
+	if !p.Config.Resample && (dst.Width != src.Width || dst.Height != src.Height) {
+		return fmt.Errorf("ntsc: destination is %dx%d, source is %dx%d", dst.Width, dst.Height, src.Width, src.Height)
+	}
+	if len(dst.Data) != dst.Width*dst.Height*3 || len(src.Data) != src.Width*src.Height*3 {
+		return fmt.Errorf("ntsc: image data does not match its dimensions")
+	}
+	if err := validateImageSize(src.Width, src.Height); err != nil {
+		return err
+	}
+	if err := validateImageSize(dst.Width, dst.Height); err != nil {
+		return err
+	}
+	// Config is exported and may have changed since NewNtscProcessor
+	if err := p.Config.Validate(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Config.BlackLineCut {
+		// Cut on a private copy so the caller's image is never modified
+		cut := src.CloneWithPool(pool.DefaultImagePool)
+		defer pool.DefaultImagePool.Put(cut)
+		p.cutBlackLineBorder(cut)
+		src = cut
+	}
+
+	// With Resample, every line holds as many samples as the active line of
+	// the standard and the frame as many lines, so the filters, which assume
+	// a pixel per sample, look the same at any input size
+	width, height := src.Width, src.Height
+	if p.Config.Resample {
+		std := p.Config.Standard()
+		width, height = std.ActiveSamples(), std.ActiveLines
+	}
+	if src.Width != width || src.Height != height {
+		scaled := pool.DefaultImagePool.Get(width, height)
+		defer pool.DefaultImagePool.Put(scaled)
+		Trace(p.Observer, "scaleIn", -1, height, func() {
+			src.ScaleInto(scaled)
+		})
+		src = scaled
+	}
+	if dst.Width == width && dst.Height == height {
+		return p.process(ctx, dst, src, progress)
+	}
+	out := pool.DefaultImagePool.Get(width, height)
+	defer pool.DefaultImagePool.Put(out)
+	if err := p.process(ctx, out, src, progress); err != nil {
+		return err
+	}
+	Trace(p.Observer, "scaleOut", -1, dst.Height, func() {
+		out.ScaleInto(dst)
+	})
+	return nil
+}
+
+// process runs the pipeline over src, writing dst of the same size.
+func (p *NtscProcessor) process(ctx context.Context, dst, src *image.Image, progress ProgressFunc) error {
+
+	// Each field works on its own copy of the YIQ planes, since stages such
+	// as colorBleed read rows that belong to the other field
+	yiq0 := pool.DefaultYIQImagePool.Get(src.Width, src.Height)
+	defer pool.DefaultYIQImagePool.Put(yiq0)
+	var err error
+	Trace(p.Observer, "bgr2yiq", -1, src.Height, func() {
+		err = p.bgr2yiq(ctx, src, yiq0)
+	})
+	if err != nil {
+		return err
+	}
+	yiq1 := pool.DefaultYIQImagePool.Get(yiq0.Width, yiq0.Height)
+	defer pool.DefaultYIQImagePool.Put(yiq1)
+	copy(yiq1.Data, yiq0.Data)
+
+	pipeline := p.Pipeline
+	if pipeline == nil {
+		pipeline = DefaultPipeline()
+	}
+	fields := [2]*Field{
+		{YIQ: yiq0, Field: 0, FieldNo: 0, Config: p.Config, processor: p, state: &p.fields[0]},
+		{YIQ: yiq1, Field: 1, FieldNo: 1, Config: p.Config, processor: p, state: &p.fields[1]},
+	}
+	run := &processRun{
+		ctx:      ctx,
+		progress: progress,
+		// bgr2yiq, then every stage and yiq2bgr for both fields
+		total: 1 + 2*(len(pipeline)+1),
+	}
+	run.advance("bgr2yiq", true)
 
 	var wg sync.WaitGroup
+	var errs [2]error
 	wg.Add(2) // Two fields to process
 
 	// Process field 0
 	go func() {
 		defer wg.Done()
-		p.compositeLayer(dst, img, yiq, 0, 0)
+		errs[0] = p.compositeLayer(run, pipeline, fields[0], dst)
 	}()
 
 	// Process field 1
 	go func() {
 		defer wg.Done()
-		p.compositeLayer(dst, img, yiq, 1, 1)
+		errs[1] = p.compositeLayer(run, pipeline, fields[1], dst)
 	}()
 
 	wg.Wait() // Wait for both fields to complete
 
-	return dst
+	if errs[0] != nil {
+		return errs[0]
+	}
+	return errs[1]
+}
+
+// processRun is the cancellation and progress state shared by both field
+// goroutines of one call.
+type processRun struct {
+	ctx      context.Context
+	progress ProgressFunc
+
+	mu    sync.Mutex
+	done  int
+	total int
+	// last is the progress reported last
+	last float64
+}
+
+func (r *processRun) advance(stage string, ran bool) {
+	if r.progress == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done++
+	if ran {
+		r.last = float64(r.done) / float64(r.total)
+		r.progress(stage, r.last)
+	}
 }
 
-func (p *NtscProcessor) bgr2yiq(img *image.Image) *YIQImage {
+// band reports that a stage is done part of the way through a field.
+// Reports that would not move progress forward, since the other field is
+// further along, are dropped.
+func (r *processRun) band(stage string, part float64) {
+	if r.progress == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if done := (float64(r.done) + part) / float64(r.total); done > r.last {
+		r.last = done
+		r.progress(stage, done)
+	}
+}
+
+// nextRow reports whether a stage should go on to row y of the field. Every
+// rowBand rows of the field it checks for cancellation and reports the
+// progress of the stage. Once the call is cancelled it returns false, and
+// the stage leaves its remaining rows as they are.
+func (p *NtscProcessor) nextRow(field, y int) bool {
+	fs := &p.fields[field&1]
+	if fs.run == nil || (y>>1)%rowBand != 0 {
+		return true
+	}
+	if fs.run.ctx.Err() != nil {
+		return false
+	}
+	if y > 1 {
+		fs.run.band(fs.stage, float64(y)/float64(fs.height))
+	}
+	return true
+}
+
+// Release returns an image obtained from ProcessImage to
+// pool.DefaultImagePool. The image must not be used afterwards.
+func Release(img *image.Image) {
+	pool.DefaultImagePool.Put(img)
+}
+
+// rowBand is the number of rows converted, or of rows of a field processed
+// by a stage, between cancellation checks.
+const rowBand = 64
+
+func (p *NtscProcessor) bgr2yiq(ctx context.Context, img *image.Image, yiq *YIQImage) error {
 	height := img.Height
 	width := img.Width
 
-	yiq := pool.DefaultYIQImagePool.Get(width, height)
 	yiqData := yiq.Data
 	imgData := img.Data
+	m := p.Config.matrix()
+	c1r, c1b, c2r, c2b := m.toC1[0], m.toC1[1], m.toC2[0], m.toC2[1]
+	// With EmulatingSetup, black sits at the setup of the standard, so the
+	// stages see luma relative to blanking, as carried on the wire
+	setup := p.Config.setupLevel()
+	span := 255 - setup
 
 	// Batch process multiple pixels at once for better cache locality
 	batchSize := 8
 	for y := 0; y < height; y++ {
+		if y%rowBand == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
 		rowStart := y * width
 		imgRowStart := rowStart * 3
 		yRowStart := rowStart
@@ -294,24 +531,32 @@ func (p *NtscProcessor) bgr2yiq(img *image.Image) *YIQImage {
 				// Use integer arithmetic where possible
 				dY := (77*r + 151*g + 28*b) >> 8 // 0.30*256, 0.59*256, 0.11*256
 
-				yiqData[yRowStart+i] = dY
-				yiqData[iRowStart+i] = (189*(r-dY) - 69*(b-dY)) >> 8
-				yiqData[qRowStart+i] = (123*(r-dY) + 105*(b-dY)) >> 8
+				if setup != 0 {
+					yiqData[yRowStart+i] = setup + (dY*span+127)/255
+				} else {
+					yiqData[yRowStart+i] = dY
+				}
+				yiqData[iRowStart+i] = (c1r*(r-dY) + c1b*(b-dY)) >> 8
+				yiqData[qRowStart+i] = (c2r*(r-dY) + c2b*(b-dY)) >> 8
 			}
 		}
 	}
 
-	return yiq
+	return nil
 }
 
 func (p *NtscProcessor) yiq2bgr(yiq *YIQImage, dst *image.Image, field int) {
 	height := yiq.Height
 	width := yiq.Width
 	dstData := dst.Data
+	m := p.Config.matrix()
+	r1, r2, g1, g2, b1, b2 := m.toR[0], m.toR[1], m.toG[0], m.toG[1], m.toB[0], m.toB[1]
+	setup := p.Config.setupLevel()
+	span := 255 - setup
 
 	// Batch processing for better cache locality
 	batchSize := 8
-	for y := field; y < height; y += 2 {
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
 		rowStart := y * width
 		dstRowStart := rowStart * 3
 		yRowStart := rowStart
@@ -326,13 +571,22 @@ func (p *NtscProcessor) yiq2bgr(yiq *YIQImage, dst *image.Image, field int) {
 
 			for i := x; i < end; i++ {
 				Y := yiq.Data[yRowStart+i]
+				if setup != 0 {
+					// Take the setup back out, rounding down so that
+					// luma below black stays below it
+					n := (Y-setup)*255 + span/2
+					Y = n / span
+					if n%span < 0 {
+						Y--
+					}
+				}
 				I := yiq.Data[iRowStart+i]
 				Q := yiq.Data[qRowStart+i]
 
 				// Use integer arithmetic for better performance
-				r := Y + (245*I+159*Q)>>8
-				g := Y - (70*I+166*Q)>>8
-				b := Y + (-283*I+436*Q)>>8
+				r := Y + (r1*I+r2*Q)>>8
+				g := Y - (g1*I+g2*Q)>>8
+				b := Y + (b1*I+b2*Q)>>8
 
 				// Clamp values using branchless operations where possible
 				if r < 0 {
@@ -360,146 +614,66 @@ func (p *NtscProcessor) yiq2bgr(yiq *YIQImage, dst *image.Image, field int) {
 	}
 }
 
-func (p *NtscProcessor) compositeLayer(dst *image.Image, src *image.Image, yiq *YIQImage, field int, fieldno int) {
-	start := time.Now()
-	if p.Config.BlackLineCut {
-		p.cutBlackLineBorder(src)
-		if debugMode {
-			fmt.Printf("DEBUG: cutBlackLineBorder took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.ColorBleedBefore && (p.Config.ColorBleedVert != 0 || p.Config.ColorBleedHoriz != 0) {
-		p.colorBleed(yiq, field)
-		if debugMode {
-			fmt.Printf("DEBUG: colorBleed took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.CompositeInChromaLowpass {
-		p.compositeLowpass(yiq, field, fieldno)
-		if debugMode {
-			fmt.Printf("DEBUG: compositeLowpass took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.Ringing != 1.0 {
-		p.ringing(yiq, field)
-		if debugMode {
-			fmt.Printf("DEBUG: ringing took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	p.chromaIntoLuma(yiq, field, fieldno, p.Config.SubcarrierAmplitude)
-	if debugMode {
-		fmt.Printf("DEBUG: chromaIntoLuma took %v\n", time.Since(start))
-	}
-
-	start = time.Now()
-	if p.Config.CompositePreemphasis != 0.0 && p.Config.CompositePreemphasisCut > 0 {
-		p.compositePreemphasis(yiq, field, p.Config.CompositePreemphasis, p.Config.CompositePreemphasisCut)
-		if debugMode {
-			fmt.Printf("DEBUG: compositePreemphasis took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.VideoNoise != 0 {
-		p.videoNoise(yiq, field, p.Config.VideoNoise)
-		if debugMode {
-			fmt.Printf("DEBUG: videoNoise took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.VHSHeadSwitching {
-		p.vhsHeadSwitching(yiq, field)
-		if debugMode {
-			fmt.Printf("DEBUG: vhsHeadSwitching took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if !p.Config.NoColorSubcarrier {
-		p.chromaFromLuma(yiq, field, fieldno, p.Config.SubcarrierAmplitudeBack)
-		if debugMode {
-			fmt.Printf("DEBUG: chromaFromLuma took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.VideoChromaNoise != 0 {
-		p.videoChromaNoise(yiq, field, p.Config.VideoChromaNoise)
-		if debugMode {
-			fmt.Printf("DEBUG: videoChromaNoise took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.VideoChromaPhaseNoise != 0 {
-		p.videoChromaPhaseNoise(yiq, field, p.Config.VideoChromaPhaseNoise)
-		if debugMode {
-			fmt.Printf("DEBUG: videoChromaPhaseNoise took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.EmulatingVHS {
-		p.emulateVHS(yiq, field, fieldno)
-		if debugMode {
-			fmt.Printf("DEBUG: emulateVHS took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.VideoChromaLoss != 0 {
-		p.vhsChromaLoss(yiq, field, p.Config.VideoChromaLoss)
-		if debugMode {
-			fmt.Printf("DEBUG: vhsChromaLoss took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if p.Config.CompositeOutChromaLowpass {
-		if p.Config.CompositeOutChromaLowpassLite {
-			p.compositeLowpassTV(yiq, field, fieldno)
-		} else {
-			p.compositeLowpass(yiq, field, fieldno)
-		}
-		if debugMode {
-			fmt.Printf("DEBUG: compositeOutChromaLowpass took %v\n", time.Since(start))
-		}
-	}
-
-	start = time.Now()
-	if !p.Config.ColorBleedBefore && (p.Config.ColorBleedVert != 0 || p.Config.ColorBleedHoriz != 0) {
-		p.colorBleed(yiq, field)
-		if debugMode {
-			fmt.Printf("DEBUG: colorBleed (after) took %v\n", time.Since(start))
+func (p *NtscProcessor) compositeLayer(run *processRun, pipeline Pipeline, f *Field, dst *image.Image) error {
+	rows := (f.YIQ.Height - f.Field + 1) / 2
+	f.state.run, f.state.height = run, f.YIQ.Height
+	defer func() {
+		f.state.run = nil
+	}()
+	seen := map[string]int{}
+	for _, stage := range pipeline {
+		if err := run.ctx.Err(); err != nil {
+			return err
+		}
+		enabled := stage.Enabled(f.Config)
+		if enabled {
+			f.occurrence = seen[stage.Name()]
+			f.state.stage = stage.Name()
+			Trace(p.Observer, stage.Name(), f.FieldNo, rows, func() {
+				stage.Apply(f)
+			})
+			// The stage stops short once the call is cancelled
+			if err := run.ctx.Err(); err != nil {
+				return err
+			}
 		}
+		seen[stage.Name()]++
+		run.advance(stage.Name(), enabled)
 	}
 
-	start = time.Now()
-	p.blurChroma(yiq, field)
-	if debugMode {
-		fmt.Printf("DEBUG: blurChroma took %v\n", time.Since(start))
+	if err := run.ctx.Err(); err != nil {
+		return err
 	}
-
-	start = time.Now()
-	p.yiq2bgr(yiq, dst, field)
-	if debugMode {
-		fmt.Printf("DEBUG: yiq2bgr took %v\n", time.Since(start))
+	f.state.stage = "yiq2bgr"
+	Trace(p.Observer, "yiq2bgr", f.FieldNo, rows, func() {
+		p.yiq2bgr(f.YIQ, dst, f.Field)
+	})
+	// A stage or yiq2bgr may have stopped short
+	if err := run.ctx.Err(); err != nil {
+		return err
 	}
+	run.advance("yiq2bgr", true)
+	return nil
 }
 
+// chromaLumaXi returns the subcarrier phase, in quarter cycles, at the start
+// of row y of the given field. PAL follows the line structure of the
+// standard. NTSC color follows VideoScanlinePhaseShift: the default of 180
+// stands for the lineAdvance of the standard, 180 degrees per line for
+// NTSC-M and NTSC-J and 270 for NTSC-4.43, while 0, 90 and 270 override it
+// with ntscQT's rules, of which 0 and 270 hold the phase of every line of a
+// field.
 func (p *NtscProcessor) chromaLumaXi(fieldno, y int) int {
+	if p.Config.isPAL() {
+		xi, _ := p.palLine(fieldno, y)
+		return xi
+	}
 	if p.Config.VideoScanlinePhaseShift == 90 {
 		return (fieldno + p.Config.VideoScanlinePhaseShiftOffset + (y >> 1)) & 3
 	} else if p.Config.VideoScanlinePhaseShift == 180 {
+		if advance := p.Config.Standard().lineAdvance(); advance != 2 {
+			return (fieldno + p.Config.VideoScanlinePhaseShiftOffset + advance*(y>>1)) & 3
+		}
 		return ((((fieldno + y) & 2) + p.Config.VideoScanlinePhaseShiftOffset) & 3)
 	} else if p.Config.VideoScanlinePhaseShift == 270 {
 		return ((fieldno + p.Config.VideoScanlinePhaseShiftOffset) & 3)
@@ -509,11 +683,16 @@ func (p *NtscProcessor) chromaLumaXi(fieldno, y int) int {
 }
 
 func (p *NtscProcessor) chromaIntoLuma(yiq *YIQImage, field, fieldno, subcarrierAmplitude int) {
+	if p.Config.isSECAM() {
+		p.secamEncode(yiq, field, fieldno, subcarrierAmplitude)
+		return
+	}
 	height := yiq.Height
 	width := yiq.Width
 
-	for y := field; y < height; y += 2 {
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
 		xi := p.chromaLumaXi(fieldno, y)
+		vSign := p.vSwitch(fieldno, y)
 
 		for x := 0; x < width; x++ {
 			umultIdx := (xi + x) % 4
@@ -525,7 +704,7 @@ func (p *NtscProcessor) chromaIntoLuma(yiq *YIQImage, field, fieldno, subcarrier
 			idxQ := 2*height*width + y*width + x
 
 			chroma := yiq.Data[idxI]*int32(subcarrierAmplitude)*p.Umult[umultIdx] +
-				yiq.Data[idxQ]*int32(subcarrierAmplitude)*p.Vmult[vmultIdx]
+				yiq.Data[idxQ]*int32(subcarrierAmplitude)*p.Vmult[vmultIdx]*vSign
 
 			yiq.Data[idxY] += chroma / 50
 			yiq.Data[idxI] = 0
@@ -545,6 +724,9 @@ type ChromaBuffers struct {
 	acc4   []int32
 	cxi    []int32
 	cxi1   []int32
+	// prevU and prevV hold the previous row for the PAL delay line
+	prevU []int32
+	prevV []int32
 }
 
 func newChromaBuffers(width int) *ChromaBuffers {
@@ -558,140 +740,141 @@ func newChromaBuffers(width int) *ChromaBuffers {
 		acc4:   make([]int32, width),
 		cxi:    make([]int32, width/2+1),
 		cxi1:   make([]int32, width/2+1),
+		prevU:  make([]int32, width),
+		prevV:  make([]int32, width),
 	}
 }
 
-func (p *NtscProcessor) chromaFromLuma(yiq *YIQImage, field, fieldno, subcarrierAmplitude int) {
+func (p *NtscProcessor) chromaFromLuma(yiq *YIQImage, buf *ChromaBuffers, field, fieldno, subcarrierAmplitude int) {
+	if p.Config.isSECAM() {
+		p.secamDecode(yiq, field, fieldno, subcarrierAmplitude)
+		return
+	}
+	for y := field; y < yiq.Height && p.nextRow(field, y); y += 2 {
+		p.demodulateRow(yiq, buf, y, p.chromaLumaXi(fieldno, y), p.vSwitch(fieldno, y), y == field, subcarrierAmplitude)
+	}
+}
+
+// demodulateRow separates row y of the luma plane into luma and the two
+// chroma planes, given the subcarrier phase xi and, for PAL, the sign of the
+// V carrier. first starts the PAL delay line over.
+func (p *NtscProcessor) demodulateRow(yiq *YIQImage, buf *ChromaBuffers, y, xi int, vSign int32, first bool, subcarrierAmplitude int) {
 	height := yiq.Height
 	width := yiq.Width
 
-	// Use pre-allocated buffers
-	if p.chromaBuffers == nil || len(p.chromaBuffers.chroma) < width {
-		p.chromaBuffers = newChromaBuffers(width)
-	}
-	buf := p.chromaBuffers
+	Y_row_start := y * width
+	I_row_start := height*width + y*width
+	Q_row_start := 2*height*width + y*width
 
-	for y := field; y < height; y += 2 {
-		Y_row_start := y * width
-		I_row_start := height*width + y*width
-		Q_row_start := 2*height*width + y*width
+	sum := yiq.Data[Y_row_start] + yiq.Data[Y_row_start+1]
 
-		sum := yiq.Data[Y_row_start] + yiq.Data[Y_row_start+1]
-
-		for i := 0; i < width-2; i++ {
-			buf.y2[i] = yiq.Data[Y_row_start+i+2]
-		}
+	for i := 0; i < width-2; i++ {
+		buf.y2[i] = yiq.Data[Y_row_start+i+2]
+	}
 
-		for i := 2; i < width; i++ {
-			buf.yd4[i] = yiq.Data[Y_row_start+i-2]
-		}
+	for i := 2; i < width; i++ {
+		buf.yd4[i] = yiq.Data[Y_row_start+i-2]
+	}
 
-		for i := 0; i < width; i++ {
-			buf.sums[i] = buf.y2[i] - buf.yd4[i]
-		}
+	for i := 0; i < width; i++ {
+		buf.sums[i] = buf.y2[i] - buf.yd4[i]
+	}
 
-		buf.sums0[0] = sum
-		for i := 0; i < width; i++ {
-			buf.sums0[i+1] = buf.sums[i]
-		}
+	buf.sums0[0] = sum
+	for i := 0; i < width; i++ {
+		buf.sums0[i+1] = buf.sums[i]
+	}
 
-		accumulator := buf.sums0[0]
-		for i := 0; i < width; i++ {
-			accumulator += buf.sums0[i+1]
-			buf.acc[i] = accumulator
-		}
+	accumulator := buf.sums0[0]
+	for i := 0; i < width; i++ {
+		accumulator += buf.sums0[i+1]
+		buf.acc[i] = accumulator
+	}
 
-		for i := 0; i < width; i++ {
-			buf.acc4[i] = buf.acc[i] / 4
-		}
+	for i := 0; i < width; i++ {
+		buf.acc4[i] = buf.acc[i] / 4
+	}
 
-		for i := 0; i < width; i++ {
-			buf.chroma[i] = buf.y2[i] - buf.acc4[i]
-		}
+	for i := 0; i < width; i++ {
+		buf.chroma[i] = buf.y2[i] - buf.acc4[i]
+	}
 
-		for i := 0; i < width; i++ {
-			yiq.Data[Y_row_start+i] = buf.acc4[i]
-		}
+	for i := 0; i < width; i++ {
+		yiq.Data[Y_row_start+i] = buf.acc4[i]
+	}
 
-		xi := p.chromaLumaXi(fieldno, y)
+	x := (4 - xi) & 3
 
-		x := (4 - xi) & 3
+	for i := x + 2; i < width; i += 4 {
+		buf.chroma[i] = -buf.chroma[i]
+	}
+	for i := x + 3; i < width; i += 4 {
+		buf.chroma[i] = -buf.chroma[i]
+	}
 
-		for i := x + 2; i < width; i += 4 {
-			buf.chroma[i] = -buf.chroma[i]
-		}
-		for i := x + 3; i < width; i += 4 {
-			buf.chroma[i] = -buf.chroma[i]
+	for i := 0; i < width; i++ {
+		if subcarrierAmplitude != 0 {
+			buf.chroma[i] = buf.chroma[i] * 50 / int32(subcarrierAmplitude)
+		} else {
+			buf.chroma[i] = 0
 		}
+	}
 
-		for i := 0; i < width; i++ {
-			if subcarrierAmplitude != 0 {
-				buf.chroma[i] = buf.chroma[i] * 50 / int32(subcarrierAmplitude)
-			} else {
-				buf.chroma[i] = 0
-			}
-		}
+	cxiCount := 0
+	for i := xi; i < width; i += 2 {
+		buf.cxi[cxiCount] = -buf.chroma[i]
+		cxiCount++
+	}
 
-		cxiCount := 0
-		for i := xi; i < width; i += 2 {
-			buf.cxi[cxiCount] = -buf.chroma[i]
-			cxiCount++
-		}
+	cxi1Count := 0
+	for i := xi + 1; i < width; i += 2 {
+		buf.cxi1[cxi1Count] = -buf.chroma[i]
+		cxi1Count++
+	}
 
-		cxi1Count := 0
-		for i := xi + 1; i < width; i += 2 {
-			buf.cxi1[cxi1Count] = -buf.chroma[i]
-			cxi1Count++
-		}
+	for i := 0; i < width; i++ {
+		yiq.Data[I_row_start+i] = 0
+		yiq.Data[Q_row_start+i] = 0
+	}
 
-		for i := 0; i < width; i++ {
-			yiq.Data[I_row_start+i] = 0
-			yiq.Data[Q_row_start+i] = 0
-		}
+	for i := 0; i < cxiCount && i*2 < width; i++ {
+		yiq.Data[I_row_start+i*2] = buf.cxi[i]
+	}
 
-		for i := 0; i < cxiCount && i*2 < width; i++ {
-			yiq.Data[I_row_start+i*2] = buf.cxi[i]
-		}
+	for i := 0; i < cxi1Count && i*2 < width; i++ {
+		yiq.Data[Q_row_start+i*2] = buf.cxi1[i]
+	}
 
-		for i := 0; i < cxi1Count && i*2 < width; i++ {
-			yiq.Data[Q_row_start+i*2] = buf.cxi1[i]
-		}
+	for x := 1; x < width-2; x += 2 {
+		yiq.Data[I_row_start+x] = (yiq.Data[I_row_start+x-1] + yiq.Data[I_row_start+x+1]) >> 1
+	}
 
-		for x := 1; x < width-2; x += 2 {
-			yiq.Data[I_row_start+x] = (yiq.Data[I_row_start+x-1] + yiq.Data[I_row_start+x+1]) >> 1
-		}
+	for x := 1; x < width-2; x += 2 {
+		yiq.Data[Q_row_start+x] = (yiq.Data[Q_row_start+x-1] + yiq.Data[Q_row_start+x+1]) >> 1
+	}
 
-		for x := 1; x < width-2; x += 2 {
-			yiq.Data[Q_row_start+x] = (yiq.Data[Q_row_start+x-1] + yiq.Data[Q_row_start+x+1]) >> 1
-		}
+	for x := width - 2; x < width; x++ {
+		yiq.Data[I_row_start+x] = 0
+		yiq.Data[Q_row_start+x] = 0
+	}
 
-		for x := width - 2; x < width; x++ {
-			yiq.Data[I_row_start+x] = 0
-			yiq.Data[Q_row_start+x] = 0
-		}
+	if p.Config.isPAL() {
+		p.palDelayLine(yiq.Data[I_row_start:I_row_start+width], yiq.Data[Q_row_start:Q_row_start+width],
+			buf, first, vSign)
 	}
 }
 
-func (p *NtscProcessor) compositeLowpass(yiq *YIQImage, field, fieldno int) {
+func (p *NtscProcessor) compositeLowpass(yiq *YIQImage, samples []float64, field, fieldno int) {
 	height := yiq.Height
 	width := yiq.Width
 
-	// Pre-allocate samples buffer
-	if p.samplesBuffer == nil || len(p.samplesBuffer) < width {
-		p.samplesBuffer = make([]float64, width)
-	}
-	samples := p.samplesBuffer[:width]
-
+	std := p.Config.Standard()
 	for comp := 1; comp < 3; comp++ {
-		cutoff := 1300000.0
-		delay := 2
-		if comp == 2 {
-			cutoff = 600000.0
-			delay = 4
-		}
+		cutoff := std.ChromaCut[comp-1]
+		delay := std.ChromaDelay[comp-1]
 
-		lp := LowpassFilters(cutoff, 0.0, NTSC_RATE)
-		for y := field; y < height; y += 2 {
+		lp := LowpassFilters(cutoff, 0.0, std.SampleRate)
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			rowStart := comp*height*width + y*width
 			for x := 0; x < width; x++ {
 				samples[x] = float64(yiq.Data[rowStart+x])
@@ -708,20 +891,15 @@ func (p *NtscProcessor) compositeLowpass(yiq *YIQImage, field, fieldno int) {
 	}
 }
 
-func (p *NtscProcessor) compositeLowpassTV(yiq *YIQImage, field, fieldno int) {
+func (p *NtscProcessor) compositeLowpassTV(yiq *YIQImage, samples []float64, field, fieldno int) {
 	height := yiq.Height
 	width := yiq.Width
 
-	if p.samplesBuffer == nil || len(p.samplesBuffer) < width {
-		p.samplesBuffer = make([]float64, width)
-	}
-	samples := p.samplesBuffer[:width]
-
 	for comp := 1; comp < 3; comp++ {
 		delay := 1
-		lp := LowpassFilters(2600000.0, 0.0, NTSC_RATE)
+		lp := LowpassFilters(p.Config.Standard().TVChromaCut, 0.0, p.Config.sampleRate())
 
-		for y := field; y < height; y += 2 {
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			rowStart := comp*height*width + y*width
 			for x := 0; x < width; x++ {
 				samples[x] = float64(yiq.Data[rowStart+x])
@@ -738,17 +916,12 @@ func (p *NtscProcessor) compositeLowpassTV(yiq *YIQImage, field, fieldno int) {
 	}
 }
 
-func (p *NtscProcessor) compositePreemphasis(yiq *YIQImage, field int, compositePreemphasis, compositePreemphasisCut float64) {
+func (p *NtscProcessor) compositePreemphasis(yiq *YIQImage, samples []float64, field int, compositePreemphasis, compositePreemphasisCut float64) {
 	height := yiq.Height
 	width := yiq.Width
 
-	if p.samplesBuffer == nil || len(p.samplesBuffer) < width {
-		p.samplesBuffer = make([]float64, width)
-	}
-	samples := p.samplesBuffer[:width]
-
-	for y := field; y < height; y += 2 {
-		pre := NewLowpassFilter(NTSC_RATE, compositePreemphasisCut, 16.0)
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
+		pre := NewLowpassFilter(p.Config.sampleRate(), compositePreemphasisCut, 16.0)
 		rowStart := y * width
 
 		for x := 0; x < width; x++ {
@@ -763,7 +936,7 @@ func (p *NtscProcessor) compositePreemphasis(yiq *YIQImage, field int, composite
 	}
 }
 
-func (p *NtscProcessor) videoNoise(yiq *YIQImage, field, videoNoise int) {
+func (p *NtscProcessor) videoNoise(yiq *YIQImage, rnd *random.XorWowRandom, field, videoNoise int) {
 	height := yiq.Height
 	width := yiq.Width
 
@@ -776,7 +949,7 @@ func (p *NtscProcessor) videoNoise(yiq *YIQImage, field, videoNoise int) {
 
 		rnds := make([]float64, width*fieldHeight)
 		for i := 0; i < len(rnds); i++ {
-			rnds[i] = float64(p.Random.NextInt()%int32(noiseMod) - int32(videoNoise))
+			rnds[i] = float64(rnd.NextInt()%int32(noiseMod) - int32(videoNoise))
 		}
 
 		noises := lp.LowpassArray(rnds)
@@ -787,17 +960,17 @@ func (p *NtscProcessor) videoNoise(yiq *YIQImage, field, videoNoise int) {
 		shiftedNoises := shiftArray(noisesInt, 1)
 
 		idx := 0
-		for y := field; y < height; y += 2 {
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			for x := 0; x < width; x++ {
 				yiq.Data[y*width+x] += shiftedNoises[idx]
 				idx++
 			}
 		}
 	} else {
-		for y := field; y < height; y += 2 {
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			rnds := make([]int32, width)
 			for x := 0; x < width; x++ {
-				rnds[x] = p.Random.NextInt()%int32(noiseMod) - int32(videoNoise)
+				rnds[x] = rnd.NextInt()%int32(noiseMod) - int32(videoNoise)
 			}
 			noise := int32(0)
 			for x := 0; x < width; x++ {
@@ -809,7 +982,7 @@ func (p *NtscProcessor) videoNoise(yiq *YIQImage, field, videoNoise int) {
 	}
 }
 
-func (p *NtscProcessor) videoChromaNoise(yiq *YIQImage, field, videoChromaNoise int) {
+func (p *NtscProcessor) videoChromaNoise(yiq *YIQImage, rnd *random.XorWowRandom, field, videoChromaNoise int) {
 	height := yiq.Height
 	width := yiq.Width
 
@@ -817,10 +990,10 @@ func (p *NtscProcessor) videoChromaNoise(yiq *YIQImage, field, videoChromaNoise
 
 	if !p.Precise {
 		// Simplified noise generation and application for potential vectorization
-		for y := field; y < height; y += 2 {
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			for x := 0; x < width; x++ {
-				rndU := p.Random.NextInt()%int32(noiseMod) - int32(videoChromaNoise)
-				rndV := p.Random.NextInt()%int32(noiseMod) - int32(videoChromaNoise)
+				rndU := rnd.NextInt()%int32(noiseMod) - int32(videoChromaNoise)
+				rndV := rnd.NextInt()%int32(noiseMod) - int32(videoChromaNoise)
 				yiq.Data[height*width+y*width+x] += rndU   // I component
 				yiq.Data[2*height*width+y*width+x] += rndV // Q component
 			}
@@ -828,29 +1001,29 @@ func (p *NtscProcessor) videoChromaNoise(yiq *YIQImage, field, videoChromaNoise
 	} else {
 		noiseU := int32(0)
 		noiseV := int32(0)
-		for y := field; y < height; y += 2 {
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			for x := 0; x < width; x++ {
 				yiq.Data[height*width+y*width+x] += noiseU
-				noiseU += p.Random.NextInt()%int32(noiseMod) - int32(videoChromaNoise)
+				noiseU += rnd.NextInt()%int32(noiseMod) - int32(videoChromaNoise)
 				noiseU = noiseU / 2
 
 				yiq.Data[2*height*width+y*width+x] += noiseV
-				noiseV += p.Random.NextInt()%int32(noiseMod) - int32(videoChromaNoise)
+				noiseV += rnd.NextInt()%int32(noiseMod) - int32(videoChromaNoise)
 				noiseV = noiseV / 2
 			}
 		}
 	}
 }
 
-func (p *NtscProcessor) videoChromaPhaseNoise(yiq *YIQImage, field, videoChromaPhaseNoise int) {
+func (p *NtscProcessor) videoChromaPhaseNoise(yiq *YIQImage, rnd *random.XorWowRandom, field, videoChromaPhaseNoise int) {
 	height := yiq.Height
 	width := yiq.Width
 
 	noiseMod := videoChromaPhaseNoise*2 + 1
 	noise := int32(0)
 
-	for y := field; y < height; y += 2 {
-		noise += p.Random.NextInt()%int32(noiseMod) - int32(videoChromaPhaseNoise)
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
+		noise += rnd.NextInt()%int32(noiseMod) - int32(videoChromaPhaseNoise)
 		noise = noise / 2
 		pi := float64(noise) * M_PI / 100
 		sinpi := math.Sin(pi)
@@ -872,7 +1045,7 @@ func (p *NtscProcessor) videoChromaPhaseNoise(yiq *YIQImage, field, videoChromaP
 	}
 }
 
-func (p *NtscProcessor) vhsHeadSwitching(yiq *YIQImage, field int) {
+func (p *NtscProcessor) vhsHeadSwitching(yiq *YIQImage, rnd *random.XorWowRandom, field int) {
 	height := yiq.Height
 	width := yiq.Width
 
@@ -881,21 +1054,23 @@ func (p *NtscProcessor) vhsHeadSwitching(yiq *YIQImage, field int) {
 	noise := 0.0
 
 	if p.Config.VHSHeadSwitchingPhaseNoise != 0.0 {
-		x := p.Random.NextInt() * p.Random.NextInt() * p.Random.NextInt() * p.Random.NextInt()
+		x := rnd.NextInt() * rnd.NextInt() * rnd.NextInt() * rnd.NextInt()
 		x %= 2000000000
 		noise = float64(x)/1000000000.0 - 1.0
 		noise *= p.Config.VHSHeadSwitchingPhaseNoise
 	}
 
-	t := float64(twidth) * 262.5
-	if !p.Config.OutputNTSC {
-		t = float64(twidth) * 312.5
+	// OutputNTSC false moves the switch as in a 625-line field
+	timing := p.Config.Standard()
+	if !p.Config.OutputNTSC && timing.Lines != PAL_BG.Lines {
+		timing = &PAL_BG
 	}
+	t := float64(twidth) * timing.FieldLines()
 
 	dynamicSwitchingPoint := p.Config.VHSHeadSwitchingPoint
 	if p.Config.HeadSwitchingSpeed != 0 {
 		speedIncrement := float64(p.Config.HeadSwitchingSpeed) / 1000.0
-		frameOffset := float64(p.Random.NextInt()%1000) / 1000.0
+		frameOffset := float64(rnd.NextInt()%1000) / 1000.0
 		dynamicSwitchingPoint += speedIncrement * frameOffset
 	}
 
@@ -904,11 +1079,8 @@ func (p *NtscProcessor) vhsHeadSwitching(yiq *YIQImage, field int) {
 	phasePoint := int(math.Mod(p.Config.VHSHeadSwitchingPhase+noise, 1.0) * t)
 	x := phasePoint % twidth
 
-	if p.Config.OutputNTSC {
-		y -= (262 - 240) * 2
-	} else {
-		y -= (312 - 288) * 2
-	}
+	// Start counting from the first active line
+	y -= (timing.Lines/2 - timing.ActiveLines/2) * 2
 
 	tx := x
 	ishif := x - twidth/2
@@ -947,17 +1119,19 @@ func (p *NtscProcessor) vhsHeadSwitching(yiq *YIQImage, field int) {
 	}
 }
 
-func (p *NtscProcessor) emulateVHS(yiq *YIQImage, field, fieldno int) {
+func (p *NtscProcessor) emulateVHS(f *Field) {
+	yiq, field, fieldno := f.YIQ, f.Field, f.FieldNo
 	vhsSpeed := p.Config.OutputVHSTapeSpeed
 
 	if p.Config.VHSEdgeWave != 0 {
-		p.vhsEdgeWave(yiq, field)
+		p.vhsEdgeWave(yiq, f.Random("vhsEdgeWave"), field)
 	}
 
 	p.vhsLumaLowpass(yiq, field, vhsSpeed.LumaCut)
 	p.vhsChromaLowpass(yiq, field, vhsSpeed.ChromaCut, vhsSpeed.ChromaDelay)
 
-	if p.Config.VHSChromaVertBlend && p.Config.OutputNTSC {
+	// PAL and SECAM decoders mix lines in their delay line already
+	if p.Config.VHSChromaVertBlend && p.Config.OutputNTSC && p.Config.Standard().Color == ColorNTSC {
 		p.vhsChromaVertBlend(yiq, field)
 	}
 
@@ -965,7 +1139,7 @@ func (p *NtscProcessor) emulateVHS(yiq *YIQImage, field, fieldno int) {
 
 	if !p.Config.VHSSVideoOut {
 		p.chromaIntoLuma(yiq, field, fieldno, p.Config.SubcarrierAmplitude)
-		p.chromaFromLuma(yiq, field, fieldno, p.Config.SubcarrierAmplitude)
+		p.chromaFromLuma(yiq, f.state.chroma(yiq.Width), field, fieldno, p.Config.SubcarrierAmplitude)
 	}
 }
 
@@ -973,10 +1147,10 @@ func (p *NtscProcessor) vhsLumaLowpass(yiq *YIQImage, field int, lumaCut float64
 	height := yiq.Height
 	width := yiq.Width
 
-	lp := LowpassFilters(lumaCut, 16.0, NTSC_RATE)
-	pre := NewLowpassFilter(NTSC_RATE, lumaCut, 16.0)
+	lp := LowpassFilters(lumaCut, 16.0, p.Config.sampleRate())
+	pre := NewLowpassFilter(p.Config.sampleRate(), lumaCut, 16.0)
 
-	for y := field; y < height; y += 2 {
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
 		samples := make([]float64, width)
 		for x := 0; x < width; x++ {
 			samples[x] = float64(yiq.Data[y*width+x])
@@ -999,8 +1173,8 @@ func (p *NtscProcessor) vhsChromaLowpass(yiq *YIQImage, field int, chromaCut flo
 	width := yiq.Width
 
 	for comp := 1; comp < 3; comp++ {
-		lp := LowpassFilters(chromaCut, 0.0, NTSC_RATE)
-		for y := field; y < height; y += 2 {
+		lp := LowpassFilters(chromaCut, 0.0, p.Config.sampleRate())
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			samples := make([]float64, width)
 			for x := 0; x < width; x++ {
 				samples[x] = float64(yiq.Data[comp*height*width+y*width+x])
@@ -1022,7 +1196,7 @@ func (p *NtscProcessor) vhsChromaVertBlend(yiq *YIQImage, field int) {
 	width := yiq.Width
 
 	for comp := 1; comp < 3; comp++ {
-		for y := field + 2; y < height; y += 2 {
+		for y := field + 2; y < height && p.nextRow(field, y); y += 2 {
 			for x := 0; x < width; x++ {
 				delay := yiq.Data[comp*height*width+(y-2)*width+x]
 				current := yiq.Data[comp*height*width+y*width+x]
@@ -1036,10 +1210,10 @@ func (p *NtscProcessor) vhsSharpen(yiq *YIQImage, field int, lumaCut float64) {
 	height := yiq.Height
 	width := yiq.Width
 
-	for y := field; y < height; y += 2 {
-		lp1 := NewLowpassFilter(NTSC_RATE, lumaCut*4, 0.0)
-		lp2 := NewLowpassFilter(NTSC_RATE, lumaCut*4, 0.0)
-		lp3 := NewLowpassFilter(NTSC_RATE, lumaCut*4, 0.0)
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
+		lp1 := NewLowpassFilter(p.Config.sampleRate(), lumaCut*4, 0.0)
+		lp2 := NewLowpassFilter(p.Config.sampleRate(), lumaCut*4, 0.0)
+		lp3 := NewLowpassFilter(p.Config.sampleRate(), lumaCut*4, 0.0)
 
 		samples := make([]float64, width)
 		for x := 0; x < width; x++ {
@@ -1062,7 +1236,7 @@ func (p *NtscProcessor) colorBleed(yiq *YIQImage, field int) {
 	width := yiq.Width
 
 	for comp := 1; comp < 3; comp++ {
-		for y := field; y < height; y += 2 {
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			for x := 0; x < width; x++ {
 				srcY := y - p.Config.ColorBleedVert
 				srcX := x - p.Config.ColorBleedHoriz
@@ -1078,16 +1252,17 @@ func (p *NtscProcessor) colorBleed(yiq *YIQImage, field int) {
 	}
 }
 
-func (p *NtscProcessor) vhsEdgeWave(yiq *YIQImage, field int) {
+func (p *NtscProcessor) vhsEdgeWave(yiq *YIQImage, rnd *random.XorWowRandom, field int) {
 	height := yiq.Height
 	width := yiq.Width
 
-	rnds := make([]int32, height/2)
+	// One shift per row of this field; field 0 has the extra row of odd heights
+	rnds := make([]int32, (height-field+1)/2)
 	for i := range rnds {
-		rnds[i] = p.Random.NextInt() % int32(p.Config.VHSEdgeWave)
+		rnds[i] = rnd.NextInt() % int32(p.Config.VHSEdgeWave)
 	}
 
-	lp := NewLowpassFilter(NTSC_RATE, p.Config.OutputVHSTapeSpeed.LumaCut, 0)
+	lp := NewLowpassFilter(p.Config.sampleRate(), p.Config.OutputVHSTapeSpeed.LumaCut, 0)
 	rndsFloat := make([]float64, len(rnds))
 	for i, v := range rnds {
 		rndsFloat[i] = float64(v)
@@ -1099,7 +1274,7 @@ func (p *NtscProcessor) vhsEdgeWave(yiq *YIQImage, field int) {
 	}
 
 	for comp := 0; comp < 3; comp++ {
-		for i, y := 0, field; y < height; i, y = i+1, y+2 {
+		for i, y := 0, field; y < height && p.nextRow(field, y); i, y = i+1, y+2 {
 			if rnds[i] != 0 {
 				shift := int(rnds[i])
 				// Create a temporary buffer for the row
@@ -1123,12 +1298,12 @@ func (p *NtscProcessor) vhsEdgeWave(yiq *YIQImage, field int) {
 	}
 }
 
-func (p *NtscProcessor) vhsChromaLoss(yiq *YIQImage, field, videoChromaLoss int) {
+func (p *NtscProcessor) vhsChromaLoss(yiq *YIQImage, rnd *random.XorWowRandom, field, videoChromaLoss int) {
 	height := yiq.Height
 	width := yiq.Width
 
-	for y := field; y < height; y += 2 {
-		if p.Random.NextInt()%100000 < int32(videoChromaLoss) {
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
+		if rnd.NextInt()%100000 < int32(videoChromaLoss) {
 			for x := 0; x < width; x++ {
 				yiq.Data[height*width+y*width+x] = 0   // I component
 				yiq.Data[2*height*width+y*width+x] = 0 // Q component
@@ -1147,7 +1322,7 @@ func (p *NtscProcessor) ringing(yiq *YIQImage, field int) {
 		defer pool.DefaultSlicePool.PutInt32(original)
 
 		for comp := 0; comp < 3; comp++ {
-			for y := field; y < height; y += 2 {
+			for y := field; y < height && p.nextRow(field, y); y += 2 {
 				// Copy data for the current component and row
 				copy(original, yiq.Data[comp*height*width+y*width:comp*height*width+(y+1)*width])
 
@@ -1161,7 +1336,7 @@ func (p *NtscProcessor) ringing(yiq *YIQImage, field int) {
 	} else {
 
 		for comp := 0; comp < 3; comp++ {
-			for y := field; y < height; y += 2 {
+			for y := field; y < height && p.nextRow(field, y); y += 2 {
 				// Create a slice for the current component and row
 				row := yiq.Data[comp*height*width+y*width : comp*height*width+(y+1)*width]
 				p.ringing2(row, p.Config.RingingPower, float64(p.Config.RingingShift))
@@ -1170,7 +1345,7 @@ func (p *NtscProcessor) ringing(yiq *YIQImage, field int) {
 	}
 }
 
-func (p *NtscProcessor) ringingFreqDomain(img []int32, alpha, noiseSize, noiseValue float64) {
+func (p *NtscProcessor) ringingFreqDomain(img []int32, rnd *random.XorWowRandom, alpha, noiseSize, noiseValue float64) {
 	width := len(img)
 	if width == 0 {
 		return
@@ -1187,11 +1362,7 @@ func (p *NtscProcessor) ringingFreqDomain(img []int32, alpha, noiseSize, noiseVa
 		complexData[i] = complex(samples[i], 0)
 	}
 
-	start := time.Now()
 	complexData = fft(complexData)
-	if debugMode {
-		fmt.Printf("DEBUG: ringingFreqDomain FFT took %v\n", time.Since(start))
-	}
 
 	complexData = fftShift(complexData)
 
@@ -1216,7 +1387,7 @@ func (p *NtscProcessor) ringingFreqDomain(img []int32, alpha, noiseSize, noiseVa
 		for i := 0; i < width; i++ {
 			if i < start || i >= stop {
 
-				noise := (p.Random.Float64() - 0.5) * noiseValue
+				noise := (rnd.Float64() - 0.5) * noiseValue
 				mask[i] = complex(real(mask[i])+noise, imag(mask[i]))
 			}
 		}
@@ -1228,11 +1399,7 @@ func (p *NtscProcessor) ringingFreqDomain(img []int32, alpha, noiseSize, noiseVa
 
 	complexData = ifftShift(complexData)
 
-	start = time.Now()
 	complexData = ifft(complexData)
-	if debugMode {
-		fmt.Printf("DEBUG: ringingFreqDomain IFFT took %v\n", time.Since(start))
-	}
 
 	minVal := samples[0]
 	maxVal := samples[0]
@@ -1275,11 +1442,7 @@ func (p *NtscProcessor) ringing2(img []int32, power int, shift float64) {
 		complexData[i] = complex(samples[i], 0)
 	}
 
-	startFFT := time.Now()
 	complexData = fft(complexData)
-	if debugMode {
-		fmt.Printf("DEBUG: ringing2 FFT took %v\n", time.Since(startFFT))
-	}
 
 	complexData = fftShift(complexData)
 
@@ -1326,11 +1489,7 @@ func (p *NtscProcessor) ringing2(img []int32, power int, shift float64) {
 
 	complexData = ifftShift(complexData)
 
-	startIFFT := time.Now()
 	complexData = ifft(complexData)
-	if debugMode {
-		fmt.Printf("DEBUG: ringing2 IFFT took %v\n", time.Since(startIFFT))
-	}
 
 	for i := 0; i < width; i++ {
 		img[i] = int32(real(complexData[i]))
@@ -1342,7 +1501,7 @@ func (p *NtscProcessor) blurChroma(yiq *YIQImage, field int) {
 	width := yiq.Width
 
 	for comp := 1; comp < 3; comp++ {
-		for y := field; y < height; y += 2 {
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
 			original := make([]int32, width)
 			copy(original, yiq.Data[comp*height*width+y*width:comp*height*width+(y+1)*width])
 
@@ -1380,11 +1539,11 @@ func RandomNtscConfig(seed uint32) *NtscConfig {
 	config.VHSEdgeWave = int(triangular(rnd, 0, 5, 0))
 
 	phases := []int{0, 90, 180, 270}
-	config.VideoScanlinePhaseShift = phases[int(rnd.NextInt())%len(phases)]
-	config.VideoScanlinePhaseShiftOffset = int(rnd.NextInt()) % 4
+	config.VideoScanlinePhaseShift = phases[randIndex(rnd, len(phases))]
+	config.VideoScanlinePhaseShiftOffset = randIndex(rnd, 4)
 
 	speeds := []VHSSpeed{VHS_SP, VHS_LP, VHS_EP}
-	config.OutputVHSTapeSpeed = speeds[int(rnd.NextInt())%len(speeds)]
+	config.OutputVHSTapeSpeed = speeds[randIndex(rnd, len(speeds))]
 
 	if rnd.Float64() < 0.8 {
 		config.Ringing = rnd.Uniform(0.3, 0.7)
@@ -1393,10 +1552,10 @@ func RandomNtscConfig(seed uint32) *NtscConfig {
 			config.FreqNoiseAmplitude = rnd.Uniform(0.5, 2.0)
 		}
 		config.EnableRinging2 = rnd.Float64() < 0.5
-		config.RingingPower = int(rnd.NextInt())%6 + 2
+		config.RingingPower = randIndex(rnd, 6) + 2
 	}
 
-	config.ColorBleedBefore = int(rnd.NextInt())%2 == 1
+	config.ColorBleedBefore = randIndex(rnd, 2) == 1
 	config.ColorBleedHoriz = int(triangular(rnd, 0, 8, 0))
 	config.ColorBleedVert = int(triangular(rnd, 0, 8, 0))
 
@@ -1407,6 +1566,12 @@ func RandomNtscConfig(seed uint32) *NtscConfig {
 	return config
 }
 
+// randIndex returns a uniform index below n. The stream is unsigned, so
+// unlike NextInt it never yields a negative index.
+func randIndex(rnd *random.XorWowRandom, n int) int {
+	return int(rnd.Next() % uint32(n))
+}
+
 func triangular(rnd *random.XorWowRandom, low, high, mode float64) float64 {
 	u := rnd.Float64()
 	c := (mode - low) / (high - low)
@@ -0,0 +1,427 @@
+package ntsc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"ntsc-wasm/pkg/image"
+	"sync"
+	"testing"
+)
+
+func testImage(width, height int) *image.Image {
+	img := image.NewImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetPixel(x, y, image.Pixel{
+				R: uint8(x * 255 / width),
+				G: uint8(y * 255 / height),
+				B: uint8((x/8 + y/8) % 2 * 255),
+			})
+		}
+	}
+	return img
+}
+
+func newProcessor(t testing.TB, config *NtscConfig) *NtscProcessor {
+	t.Helper()
+	p, err := NewNtscProcessor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// mustProcess may be called from other goroutines, so it reports errors
+// with t.Error and returns an empty image.
+func mustProcess(t testing.TB, p *NtscProcessor, src *image.Image) *image.Image {
+	t.Helper()
+	out, err := p.ProcessImage(src)
+	if err != nil {
+		t.Error(err)
+		return image.NewImage(0, 0)
+	}
+	return out
+}
+
+func processImage(t testing.TB, config *NtscConfig, src *image.Image) *image.Image {
+	t.Helper()
+	return mustProcess(t, newProcessor(t, config), src)
+}
+
+// stageConfigs enables every stage of compositeLayer at least once.
+func stageConfigs() map[string]*NtscConfig {
+	configs := map[string]*NtscConfig{}
+	add := func(name string, mutate func(c *NtscConfig)) {
+		c := DefaultNtscConfig()
+		mutate(c)
+		configs[name] = c
+	}
+
+	add("default", func(c *NtscConfig) {})
+	add("colorBleedBefore", func(c *NtscConfig) {
+		c.ColorBleedBefore = true
+		c.ColorBleedHoriz = 3
+		c.ColorBleedVert = 1
+	})
+	add("colorBleedAfter", func(c *NtscConfig) {
+		c.ColorBleedBefore = false
+		c.ColorBleedHoriz = 5
+		c.ColorBleedVert = 3
+	})
+	add("colorBleedNegative", func(c *NtscConfig) {
+		c.ColorBleedHoriz = -5
+		c.ColorBleedVert = -3
+	})
+	add("ringing", func(c *NtscConfig) { c.Ringing = 0.5 })
+	add("ringing2", func(c *NtscConfig) {
+		c.Ringing = 0.5
+		c.EnableRinging2 = true
+		c.RingingPower = 4
+		c.RingingShift = 1
+	})
+	add("compositePreemphasis", func(c *NtscConfig) { c.CompositePreemphasis = 4 })
+	add("videoNoise", func(c *NtscConfig) { c.VideoNoise = 100 })
+	add("videoNoisePrecise", func(c *NtscConfig) {
+		c.VideoNoise = 100
+		c.VideoChromaNoise = 100
+		c.Precise = true
+	})
+	add("vhsHeadSwitching", func(c *NtscConfig) {
+		c.VHSHeadSwitching = true
+		c.HeadSwitchingSpeed = 50
+	})
+	add("vhsHeadSwitchingPAL", func(c *NtscConfig) {
+		c.VHSHeadSwitching = true
+		c.OutputNTSC = false
+	})
+	add("pal", func(c *NtscConfig) {
+		c.VideoStandard = StandardPAL
+		c.PALPhaseError = 20
+		c.PALDelayLine = 0.5
+		c.EmulatingVHS = true
+		c.VHSHeadSwitching = true
+	})
+	add("palM", func(c *NtscConfig) {
+		c.VideoStandard = StandardPALM
+		c.EmulatingVHS = true
+		c.VHSHeadSwitching = true
+	})
+	add("secam", func(c *NtscConfig) {
+		c.VideoStandard = StandardSECAM
+		c.EmulatingVHS = true
+		c.VHSHeadSwitching = true
+	})
+	add("noColorSubcarrier", func(c *NtscConfig) { c.NoColorSubcarrier = true })
+	add("videoChromaNoise", func(c *NtscConfig) { c.VideoChromaNoise = 2000 })
+	add("videoChromaPhaseNoise", func(c *NtscConfig) { c.VideoChromaPhaseNoise = 20 })
+	add("emulateVHS", func(c *NtscConfig) {
+		c.EmulatingVHS = true
+		c.VHSEdgeWave = 4
+		c.OutputVHSTapeSpeed = VHS_EP
+	})
+	add("emulateVHSSVideo", func(c *NtscConfig) {
+		c.EmulatingVHS = true
+		c.VHSSVideoOut = true
+		c.VHSChromaVertBlend = false
+	})
+	add("vhsChromaLoss", func(c *NtscConfig) { c.VideoChromaLoss = 50000 })
+	add("compositeOutChromaLowpassFull", func(c *NtscConfig) { c.CompositeOutChromaLowpassLite = false })
+	add("blackLineCut", func(c *NtscConfig) { c.BlackLineCut = true })
+	for _, shift := range []int{0, 90, 270} {
+		shift := shift
+		add("scanlinePhaseShift"+string(rune('0'+shift/90)), func(c *NtscConfig) {
+			c.VideoScanlinePhaseShift = shift
+			c.VideoScanlinePhaseShiftOffset = 3
+		})
+	}
+	return configs
+}
+
+func TestProcessImageStages(t *testing.T) {
+	src := testImage(64, 48)
+	for name, config := range stageConfigs() {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			before := src.Clone()
+
+			first := processImage(t, config, src)
+			second := processImage(t, config, src)
+
+			if first.Width != src.Width || first.Height != src.Height {
+				t.Fatalf("output is %dx%d, want %dx%d", first.Width, first.Height, src.Width, src.Height)
+			}
+			if !bytes.Equal(first.Data, second.Data) {
+				t.Fatal("output is not deterministic for a fixed seed")
+			}
+			if !bytes.Equal(src.Data, before.Data) {
+				t.Fatal("source image was modified")
+			}
+		})
+	}
+}
+
+func TestProcessImageSeeds(t *testing.T) {
+	src := testImage(64, 48)
+	config := DefaultNtscConfig()
+	config.VideoNoise = 100
+	base := processImage(t, config, src)
+
+	for _, mutate := range []func(c *NtscConfig){
+		func(c *NtscConfig) { c.RandomSeed++ },
+		func(c *NtscConfig) { c.RandomSeed2++ },
+	} {
+		changed := DefaultNtscConfig()
+		changed.VideoNoise = 100
+		mutate(changed)
+		if bytes.Equal(base.Data, processImage(t, changed, src).Data) {
+			t.Error("changing a seed did not change the noise")
+		}
+	}
+}
+
+func TestProcessImagePrecise(t *testing.T) {
+	src := testImage(64, 48)
+	config := stageConfigs()["videoNoisePrecise"]
+	precise := processImage(t, config, src)
+	config.Precise = false
+	if bytes.Equal(precise.Data, processImage(t, config, src).Data) {
+		t.Error("Precise did not change the noise")
+	}
+}
+
+func TestFieldRandomStreams(t *testing.T) {
+	p := newProcessor(t, DefaultNtscConfig())
+	seen := map[uint32]string{}
+	for _, fieldno := range []int{0, 1} {
+		for _, stage := range []string{"videoNoise", "videoChromaNoise", "vhsEdgeWave", "vhsChromaLoss"} {
+			first := p.fieldRandom(fieldno, stage).Next()
+			if again := p.fieldRandom(fieldno, stage).Next(); again != first {
+				t.Errorf("field %d %s: stream is not reproducible", fieldno, stage)
+			}
+			if other, ok := seen[first]; ok {
+				t.Errorf("field %d %s: stream collides with %s", fieldno, stage, other)
+			}
+			seen[first] = stage
+		}
+	}
+}
+
+func TestProcessImageConcurrent(t *testing.T) {
+	src := testImage(64, 48)
+	configs := stageConfigs()
+
+	want := map[string][]uint8{}
+	for name, config := range configs {
+		want[name] = processImage(t, config, src).Data
+	}
+
+	// A shared processor must serialize its callers and still produce the
+	// same output as a private one
+	shared := newProcessor(t, configs["emulateVHS"])
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for name, config := range configs {
+			wg.Add(1)
+			go func(name string, config *NtscConfig) {
+				defer wg.Done()
+				got := processImage(t, config, src)
+				if !bytes.Equal(got.Data, want[name]) {
+					t.Errorf("%s: concurrent output differs", name)
+				}
+			}(name, config)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !bytes.Equal(mustProcess(t, shared, src).Data, want["emulateVHS"]) {
+				t.Error("shared processor output differs")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestProcessInto(t *testing.T) {
+	src := testImage(64, 48)
+	config := DefaultNtscConfig()
+	config.VideoNoise = 50
+	config.EmulatingVHS = true
+	p := newProcessor(t, config)
+
+	want := mustProcess(t, p, src)
+	defer Release(want)
+
+	dst := image.NewImage(src.Width, src.Height)
+	if err := p.ProcessInto(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.Data, want.Data) {
+		t.Error("ProcessInto output differs from ProcessImage")
+	}
+
+	inPlace := src.Clone()
+	if err := p.ProcessInto(inPlace, inPlace); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(inPlace.Data, want.Data) {
+		t.Error("in-place ProcessInto output differs from ProcessImage")
+	}
+
+	if err := p.ProcessInto(image.NewImage(32, 48), src); err == nil {
+		t.Error("expected an error for mismatched dimensions")
+	}
+}
+
+// barsImage draws eight vertical color bars, so every bar edge is the same
+// fraction of the width at any size.
+func barsImage(width, height int) *image.Image {
+	bars := []image.Pixel{
+		{R: 191, G: 191, B: 191}, {R: 191, G: 191}, {G: 191, B: 191}, {G: 191},
+		{R: 191, B: 191}, {R: 191}, {B: 191}, {},
+	}
+	img := image.NewImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetPixel(x, y, bars[x*len(bars)/width])
+		}
+	}
+	return img
+}
+
+// meanDifference returns the mean absolute difference of the channels of a
+// and b.
+func meanDifference(a, b *image.Image) float64 {
+	sum := 0
+	for i := range a.Data {
+		d := int(a.Data[i]) - int(b.Data[i])
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return float64(sum) / float64(len(a.Data))
+}
+
+func TestResample(t *testing.T) {
+	// The same picture at two resolutions, compared at the smaller one
+	look := func(resample bool, width, height int) *image.Image {
+		config := DefaultNtscConfig()
+		config.Resample = resample
+		config.VideoNoise = 0
+		config.EmulatingVHS = true
+		out := processImage(t, config, barsImage(width, height))
+		return out.Scale(160, 120)
+	}
+	native := meanDifference(look(false, 160, 120), look(false, 1280, 960))
+	resampled := meanDifference(look(true, 160, 120), look(true, 1280, 960))
+	if resampled*2 > native {
+		t.Errorf("mean difference between resolutions is %.2f resampled, %.2f without", resampled, native)
+	}
+
+	// The result can be scaled to any destination
+	config := DefaultNtscConfig()
+	config.Resample = true
+	dst := image.NewImage(100, 30)
+	if err := newProcessor(t, config).ProcessInto(dst, barsImage(64, 48)); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.GetPixel(40, 15); pixelDistance(got, image.Pixel{G: 191}) > 60 {
+		t.Errorf("fourth bar is %v", got)
+	}
+}
+
+func TestProcessImageContextProgress(t *testing.T) {
+	src := testImage(64, 48)
+	config := DefaultNtscConfig()
+	config.EmulatingVHS = true
+
+	var stages []string
+	last := 0.0
+	out, err := newProcessor(t, config).ProcessImageContext(context.Background(), src, func(stage string, done float64) {
+		if done <= last || done > 1 {
+			t.Errorf("%s: progress %v after %v", stage, done, last)
+		}
+		last = done
+		stages = append(stages, stage)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Release(out)
+
+	if last != 1 {
+		t.Errorf("final progress is %v, want 1", last)
+	}
+	if stages[len(stages)-1] != "yiq2bgr" {
+		t.Errorf("last stage is %q, want yiq2bgr", stages[len(stages)-1])
+	}
+}
+
+func TestProcessImageContextCancel(t *testing.T) {
+	src := testImage(64, 48)
+	p := newProcessor(t, DefaultNtscConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.ProcessImageContext(ctx, src, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("pre-cancelled context: got %v, want context.Canceled", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	_, err := p.ProcessImageContext(ctx, src, func(stage string, done float64) {
+		calls++
+		if stage == "chromaIntoLuma" {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled mid-way: got %v, want context.Canceled", err)
+	}
+	if calls > 6 {
+		t.Errorf("processing continued for %d stages after cancel", calls)
+	}
+}
+
+func TestProcessImageContextCancelInStage(t *testing.T) {
+	// Tall enough for a field to span several row bands
+	src := testImage(32, 8*rowBand)
+	config := DefaultNtscConfig()
+	config.Ringing = 0.5
+	p := newProcessor(t, config)
+	pipeline, err := NewPipeline("ringing", "blurChroma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Pipeline = pipeline
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stages []string
+	var progress []float64
+	_, err = p.ProcessImageContext(ctx, src, func(stage string, done float64) {
+		stages = append(stages, stage)
+		progress = append(progress, done)
+		if stage == "ringing" {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	// bgr2yiq, then part of ringing and nothing after it. Of 7 steps,
+	// bgr2yiq is the first and ringing the second of each field.
+	if len(stages) < 2 || stages[0] != "bgr2yiq" {
+		t.Fatalf("stages %v, want bgr2yiq and ringing", stages)
+	}
+	for i, stage := range stages[1:] {
+		if done := progress[i+1]; stage != "ringing" || done >= 2.0/7 {
+			t.Errorf("%s reported %v after cancelling in ringing", stage, done)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package ntsc
+
+import (
+	"fmt"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// EventKind tells whether an Event marks the start or the end of a stage.
+type EventKind int
+
+const (
+	StageStart EventKind = iota
+	StageEnd
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case StageStart:
+		return "start"
+	case StageEnd:
+		return "end"
+	default:
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+}
+
+// Event describes one stage of one field. Field is -1 for steps that cover
+// the whole image, such as bgr2yiq. Duration, Allocs
+// and AllocBytes are only set on StageEnd. Allocations are counted for the
+// whole process, so they include those of the other field running at the
+// same time.
+type Event struct {
+	Kind       EventKind
+	Stage      string
+	Field      int
+	Rows       int
+	Duration   time.Duration
+	Allocs     uint64
+	AllocBytes uint64
+}
+
+// Observer receives an Event before and after every stage that runs.
+// Observe is called from both field goroutines and must be safe for
+// concurrent use.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) Observe(e Event) { f(e) }
+
+var allocMetrics = []string{"/gc/heap/allocs:objects", "/gc/heap/allocs:bytes"}
+
+func readAllocs() (objects, bytes uint64) {
+	samples := make([]metrics.Sample, len(allocMetrics))
+	for i, name := range allocMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		objects = samples[0].Value.Uint64()
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		bytes = samples[1].Value.Uint64()
+	}
+	return objects, bytes
+}
+
+// Trace runs apply as a stage and reports it to observer, if any. Callers
+// can use it to add their own steps, such as decoding, to a report.
+func Trace(observer Observer, stage string, field, rows int, apply func()) {
+	if observer == nil {
+		apply()
+		return
+	}
+	observer.Observe(Event{Kind: StageStart, Stage: stage, Field: field, Rows: rows})
+	objects, bytes := readAllocs()
+	start := time.Now()
+	apply()
+	duration := time.Since(start)
+	objectsAfter, bytesAfter := readAllocs()
+	observer.Observe(Event{
+		Kind:       StageEnd,
+		Stage:      stage,
+		Field:      field,
+		Rows:       rows,
+		Duration:   duration,
+		Allocs:     objectsAfter - objects,
+		AllocBytes: bytesAfter - bytes,
+	})
+}
+
+// StageTiming accumulates the StageEnd events of one stage and field.
+type StageTiming struct {
+	Stage      string        `json:"stage"`
+	Field      int           `json:"field"`
+	Calls      int           `json:"calls"`
+	Rows       int           `json:"rows"`
+	Duration   time.Duration `json:"duration"`
+	Allocs     uint64        `json:"allocs"`
+	AllocBytes uint64        `json:"allocBytes"`
+}
+
+// TimingReport is an Observer that collects per-stage timings. It may be
+// shared by several processors or calls, in which case the timings add up.
+type TimingReport struct {
+	mu      sync.Mutex
+	timings []StageTiming
+	index   map[timingKey]int
+}
+
+type timingKey struct {
+	stage string
+	field int
+}
+
+// NewTimingReport returns an empty report.
+func NewTimingReport() *TimingReport {
+	return &TimingReport{index: map[timingKey]int{}}
+}
+
+// Observe implements Observer.
+func (r *TimingReport) Observe(e Event) {
+	if e.Kind != StageEnd {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := timingKey{e.Stage, e.Field}
+	i, ok := r.index[key]
+	if !ok {
+		i = len(r.timings)
+		r.index[key] = i
+		r.timings = append(r.timings, StageTiming{Stage: e.Stage, Field: e.Field})
+	}
+	t := &r.timings[i]
+	t.Calls++
+	t.Rows += e.Rows
+	t.Duration += e.Duration
+	t.Allocs += e.Allocs
+	t.AllocBytes += e.AllocBytes
+}
+
+// Timings returns the collected timings in the order stages first ran.
+func (r *TimingReport) Timings() []StageTiming {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]StageTiming(nil), r.timings...)
+}
+
+// Total returns the summed duration of all stages. Fields run in parallel,
+// so this is usually more than the wall-clock time.
+func (r *TimingReport) Total() time.Duration {
+	var total time.Duration
+	for _, t := range r.Timings() {
+		total += t.Duration
+	}
+	return total
+}
+
+// String formats the report as a table.
+func (r *TimingReport) String() string {
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "stage\tfield\tcalls\trows\ttime\tallocs\tbytes\t")
+	for _, t := range r.Timings() {
+		field := fmt.Sprint(t.Field)
+		if t.Field < 0 {
+			field = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%v\t%d\t%d\t\n", t.Stage, field, t.Calls, t.Rows, t.Duration, t.Allocs, t.AllocBytes)
+	}
+	tw.Flush()
+	return sb.String()
+}
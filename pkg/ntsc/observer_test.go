@@ -0,0 +1,69 @@
+package ntsc
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestObserverEvents(t *testing.T) {
+	src := testImage(64, 47)
+	config := DefaultNtscConfig()
+	config.EmulatingVHS = true
+
+	var mu sync.Mutex
+	open := map[timingKey]bool{}
+	report := NewTimingReport()
+
+	p := newProcessor(t, config)
+	p.Observer = ObserverFunc(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := timingKey{e.Stage, e.Field}
+		switch e.Kind {
+		case StageStart:
+			if open[key] {
+				t.Errorf("%s field %d started twice", e.Stage, e.Field)
+			}
+			open[key] = true
+		case StageEnd:
+			if !open[key] {
+				t.Errorf("%s field %d ended without starting", e.Stage, e.Field)
+			}
+			delete(open, key)
+		}
+		report.Observe(e)
+	})
+	Release(mustProcess(t, p, src))
+
+	if len(open) != 0 {
+		t.Errorf("stages never ended: %v", open)
+	}
+
+	timings := report.Timings()
+	if timings[0].Stage != "bgr2yiq" || timings[0].Field != -1 || timings[0].Rows != 47 {
+		t.Errorf("first timing is %+v, want bgr2yiq of all 47 rows", timings[0])
+	}
+	want := map[timingKey]int{
+		{"emulateVHS", 0}: 24,
+		{"emulateVHS", 1}: 23,
+		{"yiq2bgr", 0}:    24,
+		{"yiq2bgr", 1}:    23,
+	}
+	for _, timing := range timings {
+		if timing.Calls != 1 {
+			t.Errorf("%s field %d ran %d times", timing.Stage, timing.Field, timing.Calls)
+		}
+		if rows, ok := want[timingKey{timing.Stage, timing.Field}]; ok {
+			if timing.Rows != rows {
+				t.Errorf("%s field %d: %d rows, want %d", timing.Stage, timing.Field, timing.Rows, rows)
+			}
+			delete(want, timingKey{timing.Stage, timing.Field})
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("missing timings: %v", want)
+	}
+	if report.Total() <= 0 {
+		t.Error("report has no duration")
+	}
+}
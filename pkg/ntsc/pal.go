@@ -0,0 +1,73 @@
+package ntsc
+
+import "math"
+
+// frameLine returns the number of row y of the given field in the sequence
+// of frames, counting from the first line of frame 0. Frames have an odd
+// number of lines, so the V switch, or the color difference a SECAM line
+// carries, flips from one frame to the next.
+func (p *NtscProcessor) frameLine(fieldno, y int) int {
+	lines := p.Config.Standard().Lines
+	return p.Frame*lines + fieldno*(lines+1)/2 + y>>1
+}
+
+// palLine returns the subcarrier phase, in quarter cycles, and the sign of
+// the V carrier at the start of row y of the given field. A PAL-B/G line
+// holds 283.75 subcarrier cycles, so the phase moves three quarter cycles per
+// line and the fields repeat after four frames, eight fields, while the V
+// carrier is inverted on every other line. PAL-M and PAL-N move one quarter
+// cycle per line.
+func (p *NtscProcessor) palLine(fieldno, y int) (int, int32) {
+	line := p.frameLine(fieldno, y)
+	xi := (p.Config.Standard().lineAdvance()*line + p.Config.VideoScanlinePhaseShiftOffset) & 3
+	if line&1 == 1 {
+		return xi, -1
+	}
+	return xi, 1
+}
+
+// vSwitch returns the sign of the V carrier of row y, which is always 1
+// outside PAL.
+func (p *NtscProcessor) vSwitch(fieldno, y int) int32 {
+	if !p.Config.isPAL() {
+		return 1
+	}
+	_, sign := p.palLine(fieldno, y)
+	return sign
+}
+
+// palDelayLine finishes decoding one row of PAL chroma. The row is first
+// rotated by PALPhaseError, a phase error picked up on the way, and the V
+// switch is undone, which turns the error into hue shifts of opposite
+// direction on alternate lines. The delay line then mixes each row with the
+// previous row of the field by PALDelayLine, cancelling the hue shifts at
+// the cost of saturation. Whatever it leaves, from a partial mix or from
+// errors that differ between lines, shows as Hanover bars.
+func (p *NtscProcessor) palDelayLine(u, v []int32, buf *ChromaBuffers, first bool, vSign int32) {
+	if p.Config.PALPhaseError != 0 {
+		sin, cos := math.Sincos(p.Config.PALPhaseError * math.Pi / 180)
+		for x := range u {
+			fu, fv := float64(u[x]), float64(v[x])
+			u[x] = int32(fu*cos - fv*sin)
+			v[x] = int32(fu*sin + fv*cos)
+		}
+	}
+	if vSign < 0 {
+		for x := range v {
+			v[x] = -v[x]
+		}
+	}
+
+	prevU, prevV := buf.prevU[:len(u)], buf.prevV[:len(v)]
+	if first {
+		copy(prevU, u)
+		copy(prevV, v)
+	}
+	weight := p.Config.PALDelayLine / 2
+	for x := range u {
+		cu, cv := u[x], v[x]
+		u[x] = cu + int32(weight*float64(prevU[x]-cu))
+		v[x] = cv + int32(weight*float64(prevV[x]-cv))
+		prevU[x], prevV[x] = cu, cv
+	}
+}
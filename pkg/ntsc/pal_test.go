@@ -0,0 +1,102 @@
+package ntsc
+
+import (
+	"ntsc-wasm/pkg/image"
+	"testing"
+)
+
+func flatImage(width, height int, c image.Pixel) *image.Image {
+	img := image.NewImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetPixel(x, y, c)
+		}
+	}
+	return img
+}
+
+func pixelDistance(a, b image.Pixel) int {
+	d := 0
+	for _, v := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B)} {
+		if v < 0 {
+			v = -v
+		}
+		d += v
+	}
+	return d
+}
+
+func TestPALRoundTrip(t *testing.T) {
+	for _, c := range []image.Pixel{{R: 200, G: 60, B: 40}, {R: 40, G: 180, B: 90}, {R: 60, G: 70, B: 220}} {
+		config := DefaultNtscConfig()
+		config.VideoStandard = StandardPAL
+		config.VideoNoise = 0
+		out := processImage(t, config, flatImage(64, 48, c))
+		for _, y := range []int{20, 21, 22, 23} {
+			if got := out.GetPixel(32, y); pixelDistance(got, c) > 12 {
+				t.Errorf("%v came back as %v on row %d", c, got, y)
+			}
+		}
+	}
+}
+
+func TestPALHanoverBars(t *testing.T) {
+	src := flatImage(64, 48, image.Pixel{R: 200, G: 60, B: 40})
+	config := DefaultNtscConfig()
+	config.VideoStandard = StandardPAL
+	config.VideoNoise = 0
+	config.PALPhaseError = 30
+
+	// Without the delay line the phase error shifts the hue one way on one
+	// line and the other way on the next
+	config.PALDelayLine = 0
+	out := processImage(t, config, src)
+	if d := pixelDistance(out.GetPixel(32, 20), out.GetPixel(32, 22)); d < 60 {
+		t.Errorf("simple decoder: adjacent lines differ by %d, want Hanover bars", d)
+	}
+
+	// The delay line cancels the hue shifts
+	config.PALDelayLine = 1
+	out = processImage(t, config, src)
+	if d := pixelDistance(out.GetPixel(32, 20), out.GetPixel(32, 22)); d > 6 {
+		t.Errorf("delay-line decoder: adjacent lines differ by %d", d)
+	}
+}
+
+func TestPALFieldSequence(t *testing.T) {
+	config := DefaultNtscConfig()
+	config.VideoStandard = StandardPAL
+	p := newProcessor(t, config)
+
+	type state struct {
+		xi   int
+		sign int32
+	}
+	sequence := func(frame int) [2]state {
+		p.Frame = frame
+		var s [2]state
+		for fieldno := range s {
+			s[fieldno].xi, s[fieldno].sign = p.palLine(fieldno, fieldno)
+		}
+		return s
+	}
+
+	first := sequence(0)
+	for frame := 1; frame < 4; frame++ {
+		if sequence(frame) == first {
+			t.Errorf("frame %d repeats frame 0, want a four-frame sequence", frame)
+		}
+	}
+	if sequence(4) != first || sequence(9) != sequence(5) {
+		t.Error("field sequence does not repeat after four frames")
+	}
+
+	p.Frame = 0
+	for y := 0; y < 8; y += 2 {
+		_, a := p.palLine(0, y)
+		_, b := p.palLine(0, y+2)
+		if a != -b {
+			t.Errorf("V switch is %d on row %d and %d on row %d", a, y, b, y+2)
+		}
+	}
+}
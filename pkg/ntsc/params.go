@@ -0,0 +1,335 @@
+package ntsc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ParamType is the JSON type of an NtscConfig field.
+type ParamType string
+
+const (
+	ParamBool   ParamType = "bool"
+	ParamInt    ParamType = "int"
+	ParamFloat  ParamType = "float"
+	ParamString ParamType = "string"
+)
+
+// Condition compares another field of the config with Value. Op is "==",
+// "!=" or "in", for which Value lists the values that satisfy it.
+type Condition struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// Param describes one NtscConfig field for front ends that build their
+// controls from it. Min and Max are the limits enforced by Validate, the
+// lowest of them where they depend on the standard; SoftMin and SoftMax,
+// when set, are the narrower range a slider should offer.
+type Param struct {
+	Name        string        `json:"name"`
+	Type        ParamType     `json:"type"`
+	Group       string        `json:"group"`
+	Unit        string        `json:"unit,omitempty"`
+	Default     interface{}   `json:"default"`
+	Min         *float64      `json:"min,omitempty"`
+	Max         *float64      `json:"max,omitempty"`
+	SoftMin     *float64      `json:"softMin,omitempty"`
+	SoftMax     *float64      `json:"softMax,omitempty"`
+	Step        float64       `json:"step,omitempty"`
+	Options     []interface{} `json:"options,omitempty"`
+	Description string        `json:"description"`
+	// ActiveWhen lists the conditions under which the field has any effect.
+	ActiveWhen []Condition `json:"activeWhen,omitempty"`
+}
+
+// Active reports whether every condition of ActiveWhen holds for config.
+func (p Param) Active(config *NtscConfig) bool {
+	v := reflect.ValueOf(config).Elem()
+	for _, c := range p.ActiveWhen {
+		field := v.FieldByName(c.Field).Interface()
+		if c.Op == "in" {
+			in := false
+			for _, value := range c.Value.([]interface{}) {
+				in = in || reflect.DeepEqual(field, value)
+			}
+			if !in {
+				return false
+			}
+			continue
+		}
+		if reflect.DeepEqual(field, c.Value) != (c.Op == "==") {
+			return false
+		}
+	}
+	return true
+}
+
+func limit(v float64) *float64 { return &v }
+
+func whenEq(field string, value interface{}) Condition { return Condition{field, "==", value} }
+
+func whenNe(field string, value interface{}) Condition { return Condition{field, "!=", value} }
+
+func whenIn(field string, values []interface{}) Condition { return Condition{field, "in", values} }
+
+// standardOptions returns standardNames as param options.
+func standardOptions(match func(s *VideoStandard) bool) []interface{} {
+	var options []interface{}
+	for _, name := range standardNames(match) {
+		options = append(options, name)
+	}
+	return options
+}
+
+// whenColor holds for the standards of the given color system.
+func whenColor(color ColorSystem) Condition {
+	return whenIn("VideoStandard", standardOptions(func(s *VideoStandard) bool { return s.Color == color }))
+}
+
+var params = []Param{
+	{Name: "CompositePreemphasis", Type: ParamFloat, Group: "composite",
+		Min: limit(0), Max: limit(16), SoftMax: limit(8), Step: 0.1,
+		Description: "Boost of the high frequencies of the composite signal before noise is added, sharpening luma edges and exaggerating dot crawl."},
+	{Name: "CompositePreemphasisCut", Type: ParamFloat, Group: "composite", Unit: "Hz",
+		Min: limit(0), Max: limit(lowestNyquist()), SoftMin: limit(100000), SoftMax: limit(2000000), Step: 10000,
+		Description: "Cutoff frequency of the pre-emphasis filter.",
+		ActiveWhen:  []Condition{whenNe("CompositePreemphasis", 0.0)}},
+	{Name: "CompositeInChromaLowpass", Type: ParamBool, Group: "composite",
+		Description: "Band-limit chroma before it is modulated onto the subcarrier, as a composite encoder does."},
+	{Name: "CompositeOutChromaLowpass", Type: ParamBool, Group: "composite",
+		Description: "Band-limit chroma after demodulation, as a composite decoder does."},
+	{Name: "CompositeOutChromaLowpassLite", Type: ParamBool, Group: "composite",
+		Description: "Use the lighter filter of a typical TV set for the output chroma lowpass.",
+		ActiveWhen:  []Condition{whenEq("CompositeOutChromaLowpass", true)}},
+	{Name: "SubcarrierAmplitude", Type: ParamInt, Group: "composite",
+		Min: limit(0), Max: limit(1000), SoftMax: limit(100), Step: 1,
+		Description: "Amplitude of the chroma subcarrier when chroma is modulated into the composite signal."},
+	{Name: "SubcarrierAmplitudeBack", Type: ParamInt, Group: "composite",
+		Min: limit(0), Max: limit(1000), SoftMax: limit(100), Step: 1,
+		Description: "Amplitude assumed by the decoder when chroma is recovered from the composite signal.",
+		ActiveWhen:  []Condition{whenEq("NoColorSubcarrier", false)}},
+	{Name: "NoColorSubcarrier", Type: ParamBool, Group: "composite",
+		Description: "Skip chroma demodulation, leaving the subcarrier in luma like a black and white set."},
+	{Name: "ColorBleedBefore", Type: ParamBool, Group: "composite",
+		Description: "Apply color bleed before the composite stages instead of after them."},
+	{Name: "ColorBleedHoriz", Type: ParamInt, Group: "composite", Unit: "px",
+		Min: limit(-100), Max: limit(100), SoftMin: limit(-20), SoftMax: limit(20), Step: 1,
+		Description: "Horizontal offset of chroma relative to luma, to the right when positive."},
+	{Name: "ColorBleedVert", Type: ParamInt, Group: "composite", Unit: "lines",
+		Min: limit(-100), Max: limit(100), SoftMin: limit(-20), SoftMax: limit(20), Step: 1,
+		Description: "Vertical offset of chroma relative to luma, downwards when positive."},
+
+	{Name: "Ringing", Type: ParamFloat, Group: "ringing",
+		Min: limit(0), Max: limit(10), SoftMax: limit(3), Step: 0.1,
+		Description: "Strength of the overshoot around sharp edges; 1 disables ringing."},
+	{Name: "EnableRinging2", Type: ParamBool, Group: "ringing",
+		Description: "Use the frequency domain ringing filter shaped by RingingPower and RingingShift.",
+		ActiveWhen:  []Condition{whenNe("Ringing", 1.0)}},
+	{Name: "RingingPower", Type: ParamInt, Group: "ringing",
+		Min: limit(1), Max: limit(10), SoftMax: limit(5), Step: 1,
+		Description: "Steepness of the frequency domain ringing filter.",
+		ActiveWhen:  []Condition{whenNe("Ringing", 1.0), whenEq("EnableRinging2", true)}},
+	{Name: "RingingShift", Type: ParamInt, Group: "ringing",
+		Min: limit(-10), Max: limit(10), Step: 1,
+		Description: "Shift of the frequency domain ringing filter.",
+		ActiveWhen:  []Condition{whenNe("Ringing", 1.0), whenEq("EnableRinging2", true)}},
+	{Name: "FreqNoiseSize", Type: ParamFloat, Group: "ringing",
+		Min: limit(0), Max: limit(10), Step: 0.1,
+		Description: "Size of the frequency domain noise band. Reserved; currently has no effect."},
+	{Name: "FreqNoiseAmplitude", Type: ParamFloat, Group: "ringing",
+		Min: limit(0), Max: limit(10), Step: 0.1,
+		Description: "Amplitude of the frequency domain noise. Reserved; currently has no effect."},
+
+	{Name: "VideoNoise", Type: ParamInt, Group: "noise",
+		Min: limit(0), Max: limit(10000), SoftMax: limit(100), Step: 1,
+		Description: "Amplitude of the luma noise added to the composite signal."},
+	{Name: "VideoChromaNoise", Type: ParamInt, Group: "noise",
+		Min: limit(0), Max: limit(16384), SoftMax: limit(500), Step: 1,
+		Description: "Amplitude of the noise added to the I and Q planes."},
+	{Name: "VideoChromaPhaseNoise", Type: ParamInt, Group: "noise",
+		Min: limit(0), Max: limit(1000), SoftMax: limit(100), Step: 1,
+		Description: "Amplitude of the random per-line rotation of the chroma phase, which shifts hues."},
+	{Name: "VideoChromaLoss", Type: ParamInt, Group: "noise", Unit: "1/100000",
+		Min: limit(0), Max: limit(100000), Step: 100,
+		Description: "Probability that a line loses its chroma entirely."},
+
+	{Name: "EmulatingVHS", Type: ParamBool, Group: "vhs",
+		Description: "Pass the signal through a VHS record and playback model."},
+	{Name: "OutputVHSTapeSpeed", Type: ParamString, Group: "vhs",
+		Options:     []interface{}{"SP", "LP", "EP"},
+		Description: "Tape speed, which sets the luma and chroma bandwidth and the chroma delay.",
+		ActiveWhen:  []Condition{whenEq("EmulatingVHS", true)}},
+	{Name: "VHSOutSharpen", Type: ParamFloat, Group: "vhs",
+		Min: limit(0), Max: limit(10), SoftMax: limit(5), Step: 0.1,
+		Description: "Sharpening applied by the playback deck.",
+		ActiveWhen:  []Condition{whenEq("EmulatingVHS", true)}},
+	{Name: "VHSEdgeWave", Type: ParamInt, Group: "vhs", Unit: "px",
+		Min: limit(0), Max: limit(100), SoftMax: limit(10), Step: 1,
+		Description: "Maximum horizontal wobble of lines caused by tape tension.",
+		ActiveWhen:  []Condition{whenEq("EmulatingVHS", true)}},
+	{Name: "VHSChromaVertBlend", Type: ParamBool, Group: "vhs",
+		Description: "Blend chroma with the previous line, as the deck's comb filter does.",
+		ActiveWhen:  []Condition{whenEq("EmulatingVHS", true), whenEq("OutputNTSC", true), whenColor(ColorNTSC)}},
+	{Name: "VHSSVideoOut", Type: ParamBool, Group: "vhs",
+		Description: "Play back through S-Video, keeping luma and chroma separate.",
+		ActiveWhen:  []Condition{whenEq("EmulatingVHS", true)}},
+	{Name: "VHSHeadSwitching", Type: ParamBool, Group: "vhs",
+		Description: "Distort the bottom lines where the playback heads switch."},
+	{Name: "VHSHeadSwitchingPoint", Type: ParamFloat, Group: "vhs",
+		Min: limit(0), Max: limit(1), Step: 0.001,
+		Description: "Position of the head switch as a fraction of the frame height.",
+		ActiveWhen:  []Condition{whenEq("VHSHeadSwitching", true)}},
+	{Name: "VHSHeadSwitchingPhase", Type: ParamFloat, Group: "vhs",
+		Min: limit(0), Max: limit(1), Step: 0.001,
+		Description: "Horizontal phase of the head switch as a fraction of a line.",
+		ActiveWhen:  []Condition{whenEq("VHSHeadSwitching", true)}},
+	{Name: "VHSHeadSwitchingPhaseNoise", Type: ParamFloat, Group: "vhs",
+		Min: limit(0), Max: limit(1), Step: 0.0001,
+		Description: "Random jitter of the head switch phase.",
+		ActiveWhen:  []Condition{whenEq("VHSHeadSwitching", true)}},
+	{Name: "HeadSwitchingSpeed", Type: ParamInt, Group: "vhs",
+		Min: limit(0), Max: limit(1000), SoftMax: limit(10), Step: 1,
+		Description: "How fast the head switch point drifts between frames; 0 keeps it fixed.",
+		ActiveWhen:  []Condition{whenEq("VHSHeadSwitching", true)}},
+
+	{Name: "OutputNTSC", Type: ParamBool, Group: "scanline",
+		Description: "Use the 525-line timing of the standard; when false, 625-line timing is used for head switching.",
+		ActiveWhen:  []Condition{whenIn("VideoStandard", standardOptions(func(s *VideoStandard) bool { return s.Lines == 525 }))}},
+	{Name: "VideoStandard", Type: ParamString, Group: "standard",
+		Options:     standardOptions(nil),
+		Description: "Line structure, subcarrier and color encoding of the composite signal: NTSC with I/Q, PAL with U/V, a V switch on every other line and a delay-line decoder, or SECAM with Db and Dr frequency modulated on alternate lines. NTSC and PAL are NTSC-M and PAL-B/G; NTSC-4.43, PAL-M and PAL-N are hybrids of the two."},
+	{Name: "PALPhaseError", Type: ParamFloat, Group: "standard", Unit: "degrees",
+		Min: limit(-90), Max: limit(90), SoftMin: limit(-45), SoftMax: limit(45), Step: 1,
+		Description: "Phase error of the received chroma. The delay line turns it into a loss of saturation, or into Hanover bars where it does not fully cancel.",
+		ActiveWhen:  []Condition{whenColor(ColorPAL)}},
+	{Name: "PALDelayLine", Type: ParamFloat, Group: "standard",
+		Min: limit(0), Max: limit(1), Step: 0.01,
+		Description: "How much the decoder averages each line's chroma with the previous line; 1 is a standard delay-line decoder, 0 a simple decoder that shows phase errors as Hanover bars.",
+		ActiveWhen:  []Condition{whenColor(ColorPAL)}},
+	{Name: "EmulatingSetup", Type: ParamBool, Group: "standard",
+		Description: "Process luma with black at the setup of the standard, 7.5 IRE above blanking for NTSC-M, so that noise and filters act on the levels carried on the wire.",
+		ActiveWhen:  []Condition{whenIn("VideoStandard", standardOptions(func(s *VideoStandard) bool { return s.Setup != 0 }))}},
+	{Name: "VideoScanlinePhaseShift", Type: ParamInt, Group: "scanline", Unit: "degrees",
+		Options:     []interface{}{0, 90, 180, 270},
+		Description: "Subcarrier phase advance from one line to the next in NTSC color. 180 follows the standard, 180 degrees for NTSC-M and 270 for NTSC-4.43; 0, 90 and 270 use ntscQT's fixed rules, where 0 and 270 keep the phase of every line of a field.",
+		ActiveWhen:  []Condition{whenColor(ColorNTSC)}},
+	{Name: "VideoScanlinePhaseShiftOffset", Type: ParamInt, Group: "scanline",
+		Min: limit(0), Max: limit(3), Step: 1,
+		Description: "Initial subcarrier phase in quarter cycles."},
+
+	{Name: "BlackLineCut", Type: ParamBool, Group: "system",
+		Description: "Blank the border lines that a real capture would cut off."},
+	{Name: "Resample", Type: ParamBool, Group: "system",
+		Description: "Scale the image to the active samples and lines of the standard, 754x480 for NTSC-M, before processing and back afterwards, so the result looks the same at any input resolution."},
+	{Name: "Precise", Type: ParamBool, Group: "system",
+		Description: "Use the slower, more accurate generators for luma and chroma noise, which carry the noise from one sample to the next."},
+	{Name: "RandomSeed", Type: ParamInt, Group: "system",
+		Min: limit(0), Max: limit(4294967295), Step: 1,
+		Description: "First seed of the noise generators."},
+	{Name: "RandomSeed2", Type: ParamInt, Group: "system",
+		Min: limit(0), Max: limit(4294967295), Step: 1,
+		Description: "Second seed of the noise generators."},
+}
+
+// Params describes every field of NtscConfig, in display order.
+func Params() []Param {
+	defaults := reflect.ValueOf(DefaultNtscConfig()).Elem()
+	result := make([]Param, len(params))
+	for i, p := range params {
+		p.Default = defaults.FieldByName(p.Name).Interface()
+		if speed, ok := p.Default.(VHSSpeed); ok {
+			p.Default = vhsSpeedName(speed)
+		}
+		result[i] = p
+	}
+	return result
+}
+
+// LookupParam returns the description of the named field.
+func LookupParam(name string) (Param, bool) {
+	for _, p := range Params() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
+func vhsSpeedName(speed VHSSpeed) string {
+	for _, s := range vhsSpeedNames {
+		if speed == s.speed {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// ConfigSchema returns a JSON Schema for serialized configs. Fields are
+// optional, since partial documents are merged onto defaults.
+func ConfigSchema() ([]byte, error) {
+	properties := map[string]interface{}{
+		"Version": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     1,
+			"maximum":     ConfigVersion,
+			"description": "Schema version; older documents are migrated on load.",
+		},
+	}
+	for _, p := range Params() {
+		prop := map[string]interface{}{
+			"description": p.Description,
+			"default":     p.Default,
+		}
+		switch p.Type {
+		case ParamBool:
+			prop["type"] = "boolean"
+		case ParamInt:
+			prop["type"] = "integer"
+		case ParamFloat:
+			prop["type"] = "number"
+		case ParamString:
+			prop["type"] = "string"
+		default:
+			return nil, fmt.Errorf("ntsc: param %s has unknown type %q", p.Name, p.Type)
+		}
+		if p.Min != nil {
+			prop["minimum"] = *p.Min
+		}
+		if p.Max != nil {
+			prop["maximum"] = *p.Max
+		}
+		if p.Options != nil {
+			prop["enum"] = p.Options
+		}
+		if p.Name == "OutputVHSTapeSpeed" {
+			// Non-standard speeds are written as an object
+			prop = map[string]interface{}{
+				"description": p.Description,
+				"default":     p.Default,
+				"anyOf": []interface{}{
+					map[string]interface{}{"type": "string", "enum": p.Options},
+					map[string]interface{}{
+						"type":     "object",
+						"required": []string{"LumaCut", "ChromaCut", "ChromaDelay"},
+						"properties": map[string]interface{}{
+							"LumaCut":     map[string]interface{}{"type": "number"},
+							"ChromaCut":   map[string]interface{}{"type": "number"},
+							"ChromaDelay": map[string]interface{}{"type": "integer"},
+						},
+					},
+				},
+			}
+		}
+		properties[p.Name] = prop
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"title":      "NtscConfig",
+		"type":       "object",
+		"properties": properties,
+	}, "", "  ")
+}
@@ -0,0 +1,114 @@
+package ntsc
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParamsCoverConfig(t *testing.T) {
+	seen := map[string]bool{}
+	for _, p := range Params() {
+		if seen[p.Name] {
+			t.Errorf("%s is described twice", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Group == "" || p.Description == "" {
+			t.Errorf("%s: missing group or description", p.Name)
+		}
+		for _, c := range p.ActiveWhen {
+			if _, ok := LookupParam(c.Field); !ok {
+				t.Errorf("%s depends on unknown field %s", p.Name, c.Field)
+			}
+		}
+	}
+
+	configType := reflect.TypeOf(NtscConfig{})
+	for i := 0; i < configType.NumField(); i++ {
+		if name := configType.Field(i).Name; !seen[name] {
+			t.Errorf("%s has no Param", name)
+		}
+	}
+	if len(seen) != configType.NumField() {
+		t.Errorf("%d params for %d config fields", len(seen), configType.NumField())
+	}
+}
+
+// TestParamsMatchValidate keeps the published ranges in sync with Validate.
+func TestParamsMatchValidate(t *testing.T) {
+	for _, p := range Params() {
+		if p.Min == nil || p.Type == ParamBool || p.Name == "RandomSeed" || p.Name == "RandomSeed2" {
+			continue
+		}
+		check := func(value float64, valid bool) {
+			config := DefaultNtscConfig()
+			field := reflect.ValueOf(config).Elem().FieldByName(p.Name)
+			if p.Type == ParamInt {
+				field.SetInt(int64(value))
+			} else {
+				field.SetFloat(value)
+			}
+
+			var invalid *ValidationError
+			err := config.Validate()
+			rejected := errors.As(err, &invalid) && invalid.Field(p.Name) != nil
+			if rejected == valid {
+				t.Errorf("%s = %v: valid is %v, Validate returned %v", p.Name, value, !rejected, err)
+			}
+		}
+		check(*p.Min, true)
+		check(*p.Max, true)
+		check(*p.Min-p.Step, false)
+		check(*p.Max+p.Step, false)
+	}
+}
+
+func TestParamActive(t *testing.T) {
+	config := DefaultNtscConfig()
+	sharpen, _ := LookupParam("VHSOutSharpen")
+	power, _ := LookupParam("RingingPower")
+	if sharpen.Active(config) || power.Active(config) {
+		t.Error("VHS and ringing params active with default config")
+	}
+	config.EmulatingVHS = true
+	config.Ringing = 0.5
+	config.EnableRinging2 = true
+	if !sharpen.Active(config) || !power.Active(config) {
+		t.Error("params inactive after enabling their stages")
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	data, err := ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Default interface{} `json:"default"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Properties) != len(Params())+1 {
+		t.Errorf("schema has %d properties, want %d", len(schema.Properties), len(Params())+1)
+	}
+
+	// The defaults in the schema form a valid config
+	defaults := map[string]interface{}{}
+	for name, prop := range schema.Properties {
+		if name != "Version" {
+			defaults[name] = prop.Default
+		}
+	}
+	doc, _ := json.Marshal(defaults)
+	var config NtscConfig
+	if err := json.Unmarshal(doc, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config != *DefaultNtscConfig() {
+		t.Error("schema defaults differ from DefaultNtscConfig")
+	}
+}
@@ -0,0 +1,229 @@
+package ntsc
+
+import (
+	"fmt"
+	"ntsc-wasm/pkg/random"
+	"sync"
+)
+
+// Field is what a Stage operates on: the YIQ planes of one field together
+// with the config and the per-field resources of the running processor.
+// Only rows Field, Field+2, ... belong to the field; the other rows hold an
+// unprocessed copy of the source.
+type Field struct {
+	YIQ     *YIQImage
+	Field   int
+	FieldNo int
+	Config  *NtscConfig
+
+	processor  *NtscProcessor
+	state      *fieldState
+	occurrence int
+}
+
+// Random returns the reproducible random stream for the named stage of this
+// field. A stage that appears more than once in a pipeline gets a distinct
+// stream for every repetition.
+func (f *Field) Random(stage string) *random.XorWowRandom {
+	if f.occurrence > 0 {
+		stage = fmt.Sprintf("%s#%d", stage, f.occurrence)
+	}
+	return f.processor.fieldRandom(f.FieldNo, stage)
+}
+
+// Stage is one step of the composite pipeline. Apply is called concurrently
+// for both fields of an image, each with its own Field.
+type Stage interface {
+	Name() string
+	// Enabled reports whether the stage has any effect under config;
+	// disabled stages are skipped.
+	Enabled(config *NtscConfig) bool
+	Apply(f *Field)
+}
+
+type funcStage struct {
+	name    string
+	enabled func(config *NtscConfig) bool
+	apply   func(f *Field)
+}
+
+func (s *funcStage) Name() string { return s.name }
+
+func (s *funcStage) Enabled(config *NtscConfig) bool {
+	return s.enabled == nil || s.enabled(config)
+}
+
+func (s *funcStage) Apply(f *Field) { s.apply(f) }
+
+// NewStage builds a Stage from functions. A nil enabled means the stage
+// always runs.
+func NewStage(name string, enabled func(config *NtscConfig) bool, apply func(f *Field)) Stage {
+	return &funcStage{name: name, enabled: enabled, apply: apply}
+}
+
+// Pipeline is an ordered list of stages. Stages may repeat.
+type Pipeline []Stage
+
+// Names returns the stage names in order.
+func (pl Pipeline) Names() []string {
+	names := make([]string, len(pl))
+	for i, stage := range pl {
+		names[i] = stage.Name()
+	}
+	return names
+}
+
+// DefaultPipelineStages is the order in which the built-in stages run.
+var DefaultPipelineStages = []string{
+	"colorBleedBefore",
+	"compositeInChromaLowpass",
+	"ringing",
+	"chromaIntoLuma",
+	"compositePreemphasis",
+	"videoNoise",
+	"vhsHeadSwitching",
+	"chromaFromLuma",
+	"videoChromaNoise",
+	"videoChromaPhaseNoise",
+	"emulateVHS",
+	"vhsChromaLoss",
+	"compositeOutChromaLowpass",
+	"colorBleedAfter",
+	"blurChroma",
+}
+
+var (
+	stagesMu sync.RWMutex
+	stages   = map[string]Stage{}
+)
+
+// RegisterStage makes stage available to NewPipeline under its name.
+func RegisterStage(stage Stage) error {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+	if _, ok := stages[stage.Name()]; ok {
+		return fmt.Errorf("ntsc: stage %q is already registered", stage.Name())
+	}
+	stages[stage.Name()] = stage
+	return nil
+}
+
+// LookupStage returns the registered stage with the given name.
+func LookupStage(name string) (Stage, bool) {
+	stagesMu.RLock()
+	defer stagesMu.RUnlock()
+	stage, ok := stages[name]
+	return stage, ok
+}
+
+// NewPipeline builds a pipeline from registered stage names.
+func NewPipeline(names ...string) (Pipeline, error) {
+	pl := make(Pipeline, 0, len(names))
+	for _, name := range names {
+		stage, ok := LookupStage(name)
+		if !ok {
+			return nil, fmt.Errorf("ntsc: unknown stage %q", name)
+		}
+		pl = append(pl, stage)
+	}
+	return pl, nil
+}
+
+// DefaultPipeline returns the built-in stages in DefaultPipelineStages order.
+func DefaultPipeline() Pipeline {
+	pl, err := NewPipeline(DefaultPipelineStages...)
+	if err != nil {
+		panic(err)
+	}
+	return pl
+}
+
+func colorBleedEnabled(c *NtscConfig) bool {
+	return c.ColorBleedVert != 0 || c.ColorBleedHoriz != 0
+}
+
+var builtinStages = []Stage{
+	NewStage("colorBleedBefore", func(c *NtscConfig) bool {
+		return c.ColorBleedBefore && colorBleedEnabled(c)
+	}, func(f *Field) {
+		f.processor.colorBleed(f.YIQ, f.Field)
+	}),
+	NewStage("compositeInChromaLowpass", func(c *NtscConfig) bool {
+		return c.CompositeInChromaLowpass
+	}, func(f *Field) {
+		f.processor.compositeLowpass(f.YIQ, f.state.samples(f.YIQ.Width), f.Field, f.FieldNo)
+	}),
+	NewStage("ringing", func(c *NtscConfig) bool {
+		return c.Ringing != 1.0
+	}, func(f *Field) {
+		f.processor.ringing(f.YIQ, f.Field)
+	}),
+	NewStage("chromaIntoLuma", nil, func(f *Field) {
+		f.processor.chromaIntoLuma(f.YIQ, f.Field, f.FieldNo, f.Config.SubcarrierAmplitude)
+	}),
+	NewStage("compositePreemphasis", func(c *NtscConfig) bool {
+		return c.CompositePreemphasis != 0.0 && c.CompositePreemphasisCut > 0
+	}, func(f *Field) {
+		f.processor.compositePreemphasis(f.YIQ, f.state.samples(f.YIQ.Width), f.Field, f.Config.CompositePreemphasis, f.Config.CompositePreemphasisCut)
+	}),
+	NewStage("videoNoise", func(c *NtscConfig) bool {
+		return c.VideoNoise != 0
+	}, func(f *Field) {
+		f.processor.videoNoise(f.YIQ, f.Random("videoNoise"), f.Field, f.Config.VideoNoise)
+	}),
+	NewStage("vhsHeadSwitching", func(c *NtscConfig) bool {
+		return c.VHSHeadSwitching
+	}, func(f *Field) {
+		f.processor.vhsHeadSwitching(f.YIQ, f.Random("vhsHeadSwitching"), f.Field)
+	}),
+	NewStage("chromaFromLuma", func(c *NtscConfig) bool {
+		return !c.NoColorSubcarrier
+	}, func(f *Field) {
+		f.processor.chromaFromLuma(f.YIQ, f.state.chroma(f.YIQ.Width), f.Field, f.FieldNo, f.Config.SubcarrierAmplitudeBack)
+	}),
+	NewStage("videoChromaNoise", func(c *NtscConfig) bool {
+		return c.VideoChromaNoise != 0
+	}, func(f *Field) {
+		f.processor.videoChromaNoise(f.YIQ, f.Random("videoChromaNoise"), f.Field, f.Config.VideoChromaNoise)
+	}),
+	NewStage("videoChromaPhaseNoise", func(c *NtscConfig) bool {
+		return c.VideoChromaPhaseNoise != 0
+	}, func(f *Field) {
+		f.processor.videoChromaPhaseNoise(f.YIQ, f.Random("videoChromaPhaseNoise"), f.Field, f.Config.VideoChromaPhaseNoise)
+	}),
+	NewStage("emulateVHS", func(c *NtscConfig) bool {
+		return c.EmulatingVHS
+	}, func(f *Field) {
+		f.processor.emulateVHS(f)
+	}),
+	NewStage("vhsChromaLoss", func(c *NtscConfig) bool {
+		return c.VideoChromaLoss != 0
+	}, func(f *Field) {
+		f.processor.vhsChromaLoss(f.YIQ, f.Random("vhsChromaLoss"), f.Field, f.Config.VideoChromaLoss)
+	}),
+	NewStage("compositeOutChromaLowpass", func(c *NtscConfig) bool {
+		return c.CompositeOutChromaLowpass
+	}, func(f *Field) {
+		if f.Config.CompositeOutChromaLowpassLite {
+			f.processor.compositeLowpassTV(f.YIQ, f.state.samples(f.YIQ.Width), f.Field, f.FieldNo)
+		} else {
+			f.processor.compositeLowpass(f.YIQ, f.state.samples(f.YIQ.Width), f.Field, f.FieldNo)
+		}
+	}),
+	NewStage("colorBleedAfter", func(c *NtscConfig) bool {
+		return !c.ColorBleedBefore && colorBleedEnabled(c)
+	}, func(f *Field) {
+		f.processor.colorBleed(f.YIQ, f.Field)
+	}),
+	NewStage("blurChroma", nil, func(f *Field) {
+		f.processor.blurChroma(f.YIQ, f.Field)
+	}),
+}
+
+func init() {
+	for _, stage := range builtinStages {
+		if err := RegisterStage(stage); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package ntsc
+
+import (
+	"bytes"
+	"ntsc-wasm/pkg/image"
+	"testing"
+)
+
+func TestDefaultPipeline(t *testing.T) {
+	src := testImage(64, 48)
+	config := DefaultNtscConfig()
+	config.VideoNoise = 50
+	config.EmulatingVHS = true
+
+	implicit := processImage(t, config, src)
+
+	explicit := newProcessor(t, config)
+	explicit.Pipeline = DefaultPipeline()
+	if !bytes.Equal(implicit.Data, mustProcess(t, explicit, src).Data) {
+		t.Error("explicit default pipeline differs from the implicit one")
+	}
+
+	if got := DefaultPipeline().Names(); len(got) != len(DefaultPipelineStages) {
+		t.Errorf("default pipeline has %d stages, want %d", len(got), len(DefaultPipelineStages))
+	}
+}
+
+func TestPipelineCustomStage(t *testing.T) {
+	src := testImage(64, 48)
+
+	var calls [2]int
+	blackout := NewStage("testBlackout", nil, func(f *Field) {
+		calls[f.Field]++
+		plane := f.YIQ.Width * f.YIQ.Height
+		for comp := 0; comp < 3; comp++ {
+			for y := f.Field; y < f.YIQ.Height; y += 2 {
+				row := f.YIQ.Data[comp*plane+y*f.YIQ.Width : comp*plane+(y+1)*f.YIQ.Width]
+				for x := range row {
+					row[x] = 0
+				}
+			}
+		}
+	})
+	if err := RegisterStage(blackout); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterStage(blackout); err == nil {
+		t.Error("registering a stage twice should fail")
+	}
+
+	pipeline, err := NewPipeline("testBlackout", "blurChroma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newProcessor(t, DefaultNtscConfig())
+	p.Pipeline = pipeline
+	out := mustProcess(t, p, src)
+
+	if calls != [2]int{1, 1} {
+		t.Errorf("custom stage calls per field = %v, want [1 1]", calls)
+	}
+	for i, v := range out.Data {
+		if v != 0 {
+			t.Fatalf("byte %d is %d, want black output", i, v)
+		}
+	}
+
+	if _, err := NewPipeline("noSuchStage"); err == nil {
+		t.Error("expected an error for an unknown stage")
+	}
+}
+
+func TestPipelineRepeatedStage(t *testing.T) {
+	src := testImage(64, 48)
+	config := DefaultNtscConfig()
+	config.VideoNoise = 50
+
+	once, err := NewPipeline("chromaIntoLuma", "videoNoise", "chromaFromLuma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := NewPipeline("chromaIntoLuma", "videoNoise", "videoNoise", "chromaFromLuma")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []int
+	record := NewStage("testRecordOccurrence", nil, func(f *Field) {
+		if f.Field == 0 {
+			seen = append(seen, f.occurrence)
+		}
+	})
+	recorded := Pipeline{record, record, record}
+
+	var outs []*image.Image
+	for _, pipeline := range []Pipeline{once, twice, recorded} {
+		p := newProcessor(t, config)
+		p.Pipeline = pipeline
+		outs = append(outs, mustProcess(t, p, src))
+	}
+
+	// The second pass adds noise of its own on top of the first
+	if bytes.Equal(outs[0].Data, outs[1].Data) {
+		t.Error("repeating videoNoise did not change the output")
+	}
+
+	if len(seen) != 3 || seen[0] != 0 || seen[1] != 1 || seen[2] != 2 {
+		t.Errorf("occurrences = %v, want [0 1 2]", seen)
+	}
+
+	f := &Field{processor: newProcessor(t, config)}
+	first := f.Random("videoNoise").Next()
+	f.occurrence = 1
+	if f.Random("videoNoise").Next() == first {
+		t.Error("a repeated stage reuses the random stream of its first occurrence")
+	}
+}
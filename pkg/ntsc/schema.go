@@ -0,0 +1,124 @@
+package ntsc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ConfigVersion is the schema version written by NtscConfig.MarshalJSON.
+// Documents without a "Version" key predate versioning and are read as
+// version 1.
+const ConfigVersion = 2
+
+// configMigrations[v] upgrades a decoded version v document to version v+1.
+var configMigrations = map[int]func(doc map[string]json.RawMessage) error{
+	1: migrateTapeSpeedIndex,
+}
+
+// migrateTapeSpeedIndex rewrites the version 1 OutputVHSTapeSpeed, an index
+// into SP, LP and EP where unknown indices meant SP, as a speed name.
+func migrateTapeSpeedIndex(doc map[string]json.RawMessage) error {
+	raw, ok := doc["OutputVHSTapeSpeed"]
+	if !ok {
+		return nil
+	}
+	var index int
+	if err := json.Unmarshal(raw, &index); err != nil {
+		// Not an index; left to VHSSpeed.UnmarshalJSON
+		return nil
+	}
+	name := "SP"
+	switch index {
+	case 1:
+		name = "LP"
+	case 2:
+		name = "EP"
+	}
+	doc["OutputVHSTapeSpeed"], _ = json.Marshal(name)
+	return nil
+}
+
+// configFields has the fields of NtscConfig without its JSON methods.
+type configFields NtscConfig
+
+// MarshalJSON writes the config together with its schema version.
+func (c NtscConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version int
+		configFields
+	}{ConfigVersion, configFields(c)})
+}
+
+// UnmarshalJSON upgrades documents written by older versions before
+// decoding them. Fields the document omits are left unchanged, so partial
+// documents can be overlaid onto an existing config.
+func (c *NtscConfig) UnmarshalJSON(data []byte) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc == nil {
+		return nil
+	}
+
+	version := 1
+	if raw, ok := doc["Version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return fmt.Errorf("ntsc: invalid config version %s", raw)
+		}
+		delete(doc, "Version")
+	}
+	if version < 1 || version > ConfigVersion {
+		return fmt.Errorf("ntsc: unsupported config version %d, newest supported is %d", version, ConfigVersion)
+	}
+	for ; version < ConfigVersion; version++ {
+		if err := configMigrations[version](doc); err != nil {
+			return err
+		}
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(migrated, (*configFields)(c))
+}
+
+var vhsSpeedNames = []struct {
+	name  string
+	speed VHSSpeed
+}{
+	{"SP", VHS_SP},
+	{"LP", VHS_LP},
+	{"EP", VHS_EP},
+}
+
+type vhsSpeedFields VHSSpeed
+
+// MarshalJSON writes the standard tape speeds by name and any other speed as
+// an object with its cutoffs and delay.
+func (v VHSSpeed) MarshalJSON() ([]byte, error) {
+	for _, s := range vhsSpeedNames {
+		if v == s.speed {
+			return json.Marshal(s.name)
+		}
+	}
+	return json.Marshal(vhsSpeedFields(v))
+}
+
+// UnmarshalJSON accepts "SP", "LP", "EP" or an object with the fields of
+// VHSSpeed.
+func (v *VHSSpeed) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return json.Unmarshal(data, (*vhsSpeedFields)(v))
+	}
+	for _, s := range vhsSpeedNames {
+		if strings.EqualFold(name, s.name) {
+			*v = s.speed
+			return nil
+		}
+	}
+	return fmt.Errorf("ntsc: unknown VHS tape speed %q, want SP, LP or EP", name)
+}
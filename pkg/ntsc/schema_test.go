@@ -0,0 +1,112 @@
+package ntsc
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// configCorpus lists every file in testdata/configs with the config it must
+// load as, starting from DefaultNtscConfig. Saved configs are never edited;
+// add a new file when the schema changes.
+var configCorpus = map[string]func(c *NtscConfig){
+	"v1-default.json": func(c *NtscConfig) {},
+	"v1-vhs-ep.json": func(c *NtscConfig) {
+		c.EmulatingVHS = true
+		c.VHSOutSharpen = 0.4
+		c.VHSEdgeWave = 20
+		c.VideoChromaLoss = 30
+		c.OutputVHSTapeSpeed = VHS_EP
+		c.RandomSeed = 7
+	},
+	"v1-partial-lp.json": func(c *NtscConfig) {
+		c.VideoNoise = 40
+		c.OutputVHSTapeSpeed = VHS_LP
+	},
+	"v1-unknown-tape-speed.json": func(c *NtscConfig) {
+		c.EmulatingVHS = true
+		c.OutputVHSTapeSpeed = VHS_SP
+	},
+	"v2-broadcast-lp.json": func(c *NtscConfig) {
+		c.VideoNoise = 10
+		c.VideoChromaNoise = 5
+		c.VideoChromaPhaseNoise = 2
+		c.OutputVHSTapeSpeed = VHS_LP
+	},
+	"v2-custom-tape-speed.json": func(c *NtscConfig) {
+		c.EmulatingVHS = true
+		c.OutputVHSTapeSpeed = VHSSpeed{LumaCut: 2000000, ChromaCut: 310000, ChromaDelay: 10}
+	},
+}
+
+func TestConfigCorpus(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "configs", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(configCorpus) {
+		t.Errorf("found %d corpus files, want %d", len(paths), len(configCorpus))
+	}
+
+	for _, path := range paths {
+		name := filepath.Base(path)
+		mutate, ok := configCorpus[name]
+		if !ok {
+			t.Errorf("%s has no expectation in configCorpus", name)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := DefaultNtscConfig()
+		if err := json.Unmarshal(data, got); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		want := DefaultNtscConfig()
+		mutate(want)
+		if *got != *want {
+			t.Errorf("%s: loaded as\n%+v\nwant\n%+v", name, *got, *want)
+		}
+		if err := got.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	for name, config := range stageConfigs() {
+		data, err := json.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), `{"Version":2,`) {
+			t.Errorf("%s: missing version in %s", name, data)
+		}
+		var got NtscConfig
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != *config {
+			t.Errorf("%s: round trip changed the config", name)
+		}
+	}
+}
+
+func TestConfigVersionErrors(t *testing.T) {
+	for _, doc := range []string{
+		`{"Version": 3}`,
+		`{"Version": 0}`,
+		`{"Version": "2"}`,
+		`{"Version": 2, "OutputVHSTapeSpeed": 1}`,
+		`{"OutputVHSTapeSpeed": "XP"}`,
+	} {
+		if err := json.Unmarshal([]byte(doc), DefaultNtscConfig()); err == nil {
+			t.Errorf("%s: expected an error", doc)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package ntsc
+
+import "math"
+
+// SECAM carrier constants, in Hz. Each line carries one color difference as
+// a frequency modulated subcarrier: Dr = -1.902 (R-Y) around secamDrRest on
+// even lines and Db = 1.505 (B-Y) around secamDbRest on odd lines.
+const (
+	secamDrRest      = 4406250.0
+	secamDbRest      = 4250000.0
+	secamDrDeviation = 280000.0
+	secamDbDeviation = 230000.0
+	// The transmitter limits the carrier to this band
+	secamMinFreq = 3900000.0
+	secamMaxFreq = 4756000.0
+	// The transmitter boosts the carrier away from secamBellCenter by
+	// (1 + j16F) / (1 + j1.26F), F = f/fc - fc/f, and the receiver's bell
+	// filter, a bandpass of quality secamBellQ, undoes the numerator.
+	secamBellCenter = 4286000.0
+	secamBellQ      = 16
+	secamAntiBellQ  = 1.26
+	// secamPreemphasisCut is the corner of the video pre-emphasis applied
+	// to Dr and Db before modulation, which boosts edges up to three times.
+	secamPreemphasisCut = 85000.0
+	// secamAmplitude is the carrier amplitude at the bell center, 23% of
+	// the luma range peak to peak, for a SubcarrierAmplitude of 50.
+	secamAmplitude = 0.115 * 255
+	// secamLumaTrapQ is the quality of the receiver's luma notch.
+	secamLumaTrapQ = 1
+	// secamLeadIn is the number of back porch samples, which carry the
+	// unmodulated carrier, that the receiver filters settle on. The
+	// discriminator starts halfway, once the bell filter has settled.
+	secamLeadIn = 128
+)
+
+// Dr and Db in units of the U and V planes.
+const (
+	secamDbPerU = 1.505 / 0.492
+	secamDrPerV = -1.902 / 0.877
+)
+
+// secamCarrier describes the color difference carried by one line.
+type secamCarrier struct {
+	rest, deviation float64
+	// plane is 1 for Db, taken from U, and 2 for Dr, taken from V
+	plane int
+	// scale converts plane values to the normalized color difference
+	scale float64
+}
+
+func (p *NtscProcessor) secamLine(fieldno, y int) (secamCarrier, float64) {
+	line := p.frameLine(fieldno, y)
+	carrier := secamCarrier{secamDrRest, secamDrDeviation, 2, secamDrPerV / 255}
+	if line&1 == 1 {
+		carrier = secamCarrier{secamDbRest, secamDbDeviation, 1, secamDbPerU / 255}
+	}
+	// The carrier starts at 0, 0 and 180 degrees on successive lines and is
+	// inverted from field to field, to make it less visible
+	phase := 0.0
+	if (line%3 == 2) != (fieldno&1 == 1) {
+		phase = math.Pi
+	}
+	return carrier, phase
+}
+
+// wave writes the transmitted carrier of one line to out: secamLeadIn
+// samples of back porch at rest, ending in phase, followed by the carrier
+// modulated by row, which is nil for the back porch alone.
+func (c secamCarrier) wave(out []float64, row []int32, phase, amplitude, rate float64) {
+	phase -= secamLeadIn * 2 * math.Pi * c.rest / rate
+	for i := 0; i < secamLeadIn; i++ {
+		phase += 2 * math.Pi * c.rest / rate
+		out[i] = amplitude * math.Cos(phase)
+	}
+
+	// Video pre-emphasis (1 + jf/f1) / (1 + jf/3f1), written as a highpass
+	// at 3 f1 added twice. The back porch is at rest, so the first column
+	// overshoots like any other edge.
+	pre := NewLowpassFilter(rate, secamPreemphasisCut*3, 0)
+	for x, v := range row {
+		d := float64(v) * c.scale
+		d += 2 * pre.Highpass(d)
+		f := math.Max(secamMinFreq, math.Min(secamMaxFreq, c.rest+c.deviation*d))
+		phase += 2 * math.Pi * f / rate
+		out[secamLeadIn+x] = amplitude * math.Cos(phase)
+	}
+
+	newAntiBell(rate, secamBellCenter, secamBellQ, secamAntiBellQ).filter(out[:secamLeadIn+len(row)])
+}
+
+// secamEncode replaces the chroma of the field by frequency modulated Db and
+// Dr carriers on alternate lines, added to luma. Unlike NTSC and PAL, half
+// of the color information is lost here: each line keeps only one color
+// difference.
+func (p *NtscProcessor) secamEncode(yiq *YIQImage, field, fieldno, subcarrierAmplitude int) {
+	height := yiq.Height
+	width := yiq.Width
+	rate := p.Config.sampleRate()
+	amplitude := secamAmplitude * float64(subcarrierAmplitude) / 50
+	wave := make([]float64, secamLeadIn+width)
+
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
+		carrier, phase := p.secamLine(fieldno, y)
+		chroma := yiq.Data[carrier.plane*height*width+y*width : carrier.plane*height*width+(y+1)*width]
+		luma := yiq.Data[y*width : (y+1)*width]
+
+		carrier.wave(wave, chroma, phase, amplitude, rate)
+		for x := range luma {
+			luma[x] += int32(wave[secamLeadIn+x])
+		}
+	}
+
+	for comp := 1; comp < 3; comp++ {
+		for y := field; y < height && p.nextRow(field, y); y += 2 {
+			row := yiq.Data[comp*height*width+y*width : comp*height*width+(y+1)*width]
+			for x := range row {
+				row[x] = 0
+			}
+		}
+	}
+}
+
+// secamDecode separates the carrier from luma with a notch, isolates it
+// with the bell filter and recovers the color difference of each line with
+// a limiting frequency discriminator. The missing color difference comes
+// from the previous line through the delay line, which halves the vertical
+// color resolution. Near the ends of the band the carrier is weak, so noise
+// and the clipped overshoot of saturated edges make the discriminator jump,
+// and the de-emphasis smears the jumps into horizontal streaks: SECAM fire.
+func (p *NtscProcessor) secamDecode(yiq *YIQImage, field, fieldno, subcarrierAmplitude int) {
+	height := yiq.Height
+	width := yiq.Width
+	rate := p.Config.sampleRate()
+	amplitude := secamAmplitude * float64(subcarrierAmplitude) / 50
+	n := secamLeadIn + width
+	samples := make([]float64, n)
+	chroma := make([]float64, n)
+	re := make([]float64, n)
+	im := make([]float64, n)
+	w0 := 2 * math.Pi * secamBellCenter / rate
+
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
+		carrier, phase := p.secamLine(fieldno, y)
+		luma := yiq.Data[y*width : (y+1)*width]
+
+		// The back porch carries the carrier at rest
+		carrier.wave(samples, nil, phase, amplitude, rate)
+		for i := 0; i < secamLeadIn; i++ {
+			samples[i] += float64(luma[0])
+		}
+		for x := 0; x < width; x++ {
+			samples[secamLeadIn+x] = float64(luma[x])
+		}
+
+		copy(chroma, samples)
+		newBandpass(rate, secamBellCenter, secamBellQ).filter(chroma)
+		trap := newNotch(rate, secamBellCenter, secamLumaTrapQ)
+		trap.filter(samples)
+		for x := 0; x < width; x++ {
+			luma[x] = int32(samples[secamLeadIn+x])
+		}
+
+		// Mix down to baseband around the bell center
+		for i, c := range chroma {
+			sin, cos := math.Sincos(w0 * float64(i))
+			re[i] = c * cos
+			im[i] = -c * sin
+		}
+		for _, lp := range LowpassFilters(1000000, 0, rate) {
+			re = lp.LowpassArray(re)
+		}
+		for _, lp := range LowpassFilters(1000000, 0, rate) {
+			im = lp.LowpassArray(im)
+		}
+
+		// The phase step between samples is the instantaneous frequency,
+		// whatever the amplitude, as behind a limiter
+		de := NewLowpassFilter(rate, secamPreemphasisCut, 0)
+		plane := yiq.Data[carrier.plane*height*width+y*width : carrier.plane*height*width+(y+1)*width]
+		for i := secamLeadIn / 2; i < n; i++ {
+			step := math.Atan2(im[i]*re[i-1]-re[i]*im[i-1], re[i]*re[i-1]+im[i]*im[i-1])
+			f := secamBellCenter + step*rate/(2*math.Pi)
+			d := (f - carrier.rest) / carrier.deviation
+			// De-emphasis (1 + jf/3f1) / (1 + jf/f1)
+			d -= 2.0 / 3 * de.Highpass(d)
+			if x := i - secamLeadIn; x >= 0 {
+				plane[x] = int32(math.Max(-2, math.Min(2, d)) / carrier.scale)
+			}
+		}
+	}
+
+	// Fill in the other color difference from the neighbouring line of the
+	// field, the previous one where there is one
+	for y := field; y < height && p.nextRow(field, y); y += 2 {
+		carrier, _ := p.secamLine(fieldno, y)
+		other := 3 - carrier.plane
+		from := y - 2
+		if from < field {
+			from = y + 2
+		}
+		row := yiq.Data[other*height*width+y*width : other*height*width+(y+1)*width]
+		if from >= height {
+			for x := range row {
+				row[x] = 0
+			}
+			continue
+		}
+		copy(row, yiq.Data[other*height*width+from*width:other*height*width+(from+1)*width])
+	}
+}
+
+// biquad is a second order IIR filter from the RBJ audio EQ cookbook.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// newBandpass returns a bandpass with unity gain at center.
+func newBandpass(rate, center, q float64) *biquad {
+	w := 2 * math.Pi * center / rate
+	alpha := math.Sin(w) / (2 * q)
+	a0 := 1 + alpha
+	return &biquad{alpha / a0, 0, -alpha / a0, -2 * math.Cos(w) / a0, (1 - alpha) / a0}
+}
+
+// newNotch returns a filter that removes center.
+func newNotch(rate, center, q float64) *biquad {
+	w := 2 * math.Pi * center / rate
+	alpha := math.Sin(w) / (2 * q)
+	a0 := 1 + alpha
+	return &biquad{1 / a0, -2 * math.Cos(w) / a0, 1 / a0, -2 * math.Cos(w) / a0, (1 - alpha) / a0}
+}
+
+// newAntiBell returns the transmitter's pre-emphasis, the inverse of a
+// bandpass of quality q followed by one of quality wide. Its gain is 1 at
+// center and grows to q/wide far from it.
+func newAntiBell(rate, center, q, wide float64) *biquad {
+	w := 2 * math.Pi * center / rate
+	alphaN := math.Sin(w) / (2 * q)
+	alphaD := math.Sin(w) / (2 * wide)
+	a0 := 1 + alphaD
+	g := q / wide
+	return &biquad{g * (1 + alphaN) / a0, g * -2 * math.Cos(w) / a0, g * (1 - alphaN) / a0, -2 * math.Cos(w) / a0, (1 - alphaD) / a0}
+}
+
+// filter filters samples in place, starting from rest.
+func (f *biquad) filter(samples []float64) {
+	var x1, x2, y1, y2 float64
+	for i, x := range samples {
+		y := f.b0*x + f.b1*x1 + f.b2*x2 - f.a1*y1 - f.a2*y2
+		x2, x1 = x1, x
+		y2, y1 = y1, y
+		samples[i] = y
+	}
+}
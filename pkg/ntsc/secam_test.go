@@ -0,0 +1,108 @@
+package ntsc
+
+import (
+	"ntsc-wasm/pkg/image"
+	"testing"
+)
+
+func secamConfig() *NtscConfig {
+	config := DefaultNtscConfig()
+	config.VideoStandard = StandardSECAM
+	config.VideoNoise = 0
+	return config
+}
+
+// meanPixel averages 16 pixels of row y from x, over the carrier dots the
+// luma trap leaves.
+func meanPixel(img *image.Image, x, y int) image.Pixel {
+	var r, g, b int
+	for i := 0; i < 16; i++ {
+		p := img.GetPixel(x+i, y)
+		r, g, b = r+int(p.R), g+int(p.G), b+int(p.B)
+	}
+	return image.Pixel{R: uint8(r / 16), G: uint8(g / 16), B: uint8(b / 16)}
+}
+
+func TestSECAMRoundTrip(t *testing.T) {
+	for _, c := range []image.Pixel{{R: 200, G: 60, B: 40}, {R: 40, G: 180, B: 90}, {R: 60, G: 70, B: 220}, {R: 128, G: 128, B: 128}} {
+		out := processImage(t, secamConfig(), flatImage(96, 48, c))
+		for _, y := range []int{20, 21, 22, 23} {
+			if got := meanPixel(out, 56, y); pixelDistance(got, c) > 24 {
+				t.Errorf("%v came back as %v on row %d", c, got, y)
+			}
+		}
+	}
+}
+
+func TestSECAMVerticalColorLoss(t *testing.T) {
+	// Red above blue, split on an even row so it falls between lines of
+	// both fields
+	src := image.NewImage(96, 48)
+	red, blue := image.Pixel{R: 200, G: 40, B: 40}, image.Pixel{R: 40, G: 40, B: 200}
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 96; x++ {
+			if y < 24 {
+				src.SetPixel(x, y, red)
+			} else {
+				src.SetPixel(x, y, blue)
+			}
+		}
+	}
+
+	// Each line carries one color difference and takes the other from the
+	// line above, so one line below the edge mixes both colors
+	out := processImage(t, secamConfig(), src)
+	mixed := 0
+	for _, y := range []int{24, 25, 26, 27} {
+		if got := out.GetPixel(64, y); pixelDistance(got, blue) > 60 {
+			mixed++
+		}
+	}
+	if mixed == 0 {
+		t.Error("SECAM: no row below the edge mixes the colors above")
+	}
+
+	config := DefaultNtscConfig()
+	config.VideoNoise = 0
+	out = processImage(t, config, src)
+	for _, y := range []int{26, 27} {
+		if got := out.GetPixel(64, y); pixelDistance(got, blue) > 60 {
+			t.Errorf("NTSC: row %d is %v, want %v", y, got, blue)
+		}
+	}
+}
+
+// chromaStreak measures the chroma error to the right of a saturated
+// vertical edge, summed over a few rows.
+func chromaStreak(t *testing.T, config *NtscConfig) int {
+	src := image.NewImage(96, 48)
+	fill := image.Pixel{R: 40, G: 40, B: 220}
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 96; x++ {
+			if x < 48 {
+				src.SetPixel(x, y, image.Pixel{R: 230, G: 220, B: 20})
+			} else {
+				src.SetPixel(x, y, fill)
+			}
+		}
+	}
+	out := processImage(t, config, src)
+	sum := 0
+	for y := 20; y < 28; y++ {
+		for x := 52; x < 72; x++ {
+			sum += pixelDistance(out.GetPixel(x, y), fill)
+		}
+	}
+	return sum
+}
+
+func TestSECAMFire(t *testing.T) {
+	// The discriminator and de-emphasis smear a saturated edge over many
+	// more samples than PAL's quadrature demodulator
+	pal := DefaultNtscConfig()
+	pal.VideoStandard = StandardPAL
+	pal.VideoNoise = 0
+	if s, p := chromaStreak(t, secamConfig()), chromaStreak(t, pal); s < 2*p {
+		t.Errorf("SECAM streak %d, PAL streak %d, want SECAM fire", s, p)
+	}
+}
@@ -0,0 +1,314 @@
+package ntsc
+
+import "math"
+
+// Names of the video standards selectable with NtscConfig.VideoStandard.
+// StandardNTSC and StandardPAL are aliases of NTSC-M and PAL-B/G.
+const (
+	StandardNTSC    = "NTSC"
+	StandardPAL     = "PAL"
+	StandardNTSCM   = "NTSC-M"
+	StandardNTSCJ   = "NTSC-J"
+	StandardNTSC443 = "NTSC-4.43"
+	StandardPALM    = "PAL-M"
+	StandardPALN    = "PAL-N"
+	StandardPALBG   = "PAL-B/G"
+	StandardSECAM   = "SECAM"
+)
+
+// PAL_RATE is the sample rate of one pixel in PAL-B/G and SECAM mode, four
+// times the 4.43361875 MHz PAL subcarrier, so a PAL pixel is again a quarter
+// cycle.
+const PAL_RATE = 4433618.75 * 4
+
+// ColorSystem is the way a standard carries color on the composite signal.
+type ColorSystem int
+
+const (
+	// ColorNTSC modulates I and Q in quadrature on the subcarrier.
+	ColorNTSC ColorSystem = iota
+	// ColorPAL modulates U and V in quadrature and inverts V on every other
+	// line.
+	ColorPAL
+	// ColorSECAM frequency modulates Db and Dr on alternate lines.
+	ColorSECAM
+)
+
+// VideoStandard describes the line structure and color encoding of a
+// broadcast standard. Hybrids such as NTSC-4.43 or PAL-M combine the line
+// structure of one standard with the color system of another.
+type VideoStandard struct {
+	Name  string
+	Color ColorSystem
+	// Lines is the number of lines of a frame of two fields, of which
+	// ActiveLines hold the picture.
+	Lines       int
+	ActiveLines int
+	// FieldRate is the number of fields per second.
+	FieldRate float64
+	// ActiveTime is the duration of the picture part of a line in seconds.
+	ActiveTime float64
+	// Subcarrier is the color subcarrier frequency in Hz. SECAM has one
+	// carrier per color difference and samples as PAL does.
+	Subcarrier float64
+	// SampleRate is the rate of one pixel in Hz, four times Subcarrier.
+	SampleRate float64
+	// Setup is the black level above blanking in IRE. With
+	// EmulatingSetup, the stages process luma with black at this level.
+	Setup float64
+	// ChromaCut is the bandwidth in Hz of each chroma plane, and
+	// ChromaDelay the delay in pixels of the lowpass that limits it.
+	ChromaCut   [2]float64
+	ChromaDelay [2]int
+	// TVChromaCut is the bandwidth in Hz the chroma of a TV decoder is
+	// limited to when CompositeOutChromaLowpassLite is set.
+	TVChromaCut float64
+	// Timing is the blanking and sync of each line and field.
+	Timing *LineTiming
+
+	matrix *colorMatrix
+}
+
+// LineTiming describes the blanking interval of a line and the vertical
+// sync of a field. Durations are in seconds and levels in IRE, with blanking
+// at 0.
+type LineTiming struct {
+	// A line starts at the leading edge of Sync, followed by the back porch,
+	// the active picture and the front porch.
+	FrontPorch, Sync, BackPorch float64
+	// BurstStart is the start of the colorburst after the leading edge of
+	// sync, and BurstAmplitude its peak level.
+	BurstStart     float64
+	BurstCycles    int
+	BurstAmplitude float64
+	// Vertical sync is VSyncPulses equalizing pulses, as many broad pulses
+	// and again as many equalizing pulses, all at half-line intervals.
+	// Equalizing and Broad are the widths of the pulses.
+	VSyncPulses       int
+	Equalizing, Broad float64
+	SyncLevel         float64
+}
+
+var (
+	// Timing525 is the timing of 525-line standards.
+	Timing525 = LineTiming{
+		FrontPorch: 1.5e-6, Sync: 4.7e-6, BackPorch: 4.7e-6,
+		BurstStart: 5.3e-6, BurstCycles: 9, BurstAmplitude: 20,
+		VSyncPulses: 6, Equalizing: 2.3e-6, Broad: 27.1e-6, SyncLevel: -40,
+	}
+	// Timing625 is the timing of 625-line standards, where sync is 300 mV
+	// below blanking for a 700 mV picture.
+	Timing625 = LineTiming{
+		FrontPorch: 1.65e-6, Sync: 4.7e-6, BackPorch: 5.7e-6,
+		BurstStart: 5.6e-6, BurstCycles: 10, BurstAmplitude: 21.5,
+		VSyncPulses: 5, Equalizing: 2.35e-6, Broad: 27.3e-6, SyncLevel: -300.0 / 7,
+	}
+)
+
+var (
+	NTSC_M = VideoStandard{
+		Name: StandardNTSCM, Color: ColorNTSC, Lines: 525, ActiveLines: 480, FieldRate: 60 / 1.001, ActiveTime: 52.66e-6,
+		Subcarrier: 315000000.0 / 88, SampleRate: NTSC_RATE, Setup: 7.5,
+		ChromaCut: [2]float64{1300000, 600000}, ChromaDelay: [2]int{2, 4}, TVChromaCut: 2600000,
+		Timing: &Timing525, matrix: &yiqMatrix,
+	}
+	// NTSC_J is NTSC-M without setup, so black sits at blanking.
+	NTSC_J = VideoStandard{
+		Name: StandardNTSCJ, Color: ColorNTSC, Lines: 525, ActiveLines: 480, FieldRate: 60 / 1.001, ActiveTime: 52.66e-6,
+		Subcarrier: 315000000.0 / 88, SampleRate: NTSC_RATE, Setup: 0,
+		ChromaCut: [2]float64{1300000, 600000}, ChromaDelay: [2]int{2, 4}, TVChromaCut: 2600000,
+		Timing: &Timing525, matrix: &yiqMatrix,
+	}
+	// NTSC_443 is NTSC color on the PAL subcarrier at 525 lines, as played
+	// back by multi-standard VCRs. Its subcarrier advances 270 degrees per
+	// line, which chromaLumaXi follows unless VideoScanlinePhaseShift
+	// overrides it.
+	NTSC_443 = VideoStandard{
+		Name: StandardNTSC443, Color: ColorNTSC, Lines: 525, ActiveLines: 480, FieldRate: 60 / 1.001, ActiveTime: 52.66e-6,
+		Subcarrier: 4433618.75, SampleRate: PAL_RATE, Setup: 7.5,
+		ChromaCut: [2]float64{1300000, 600000}, ChromaDelay: [2]int{2, 4}, TVChromaCut: 2600000,
+		Timing: &Timing525, matrix: &yiqMatrix,
+	}
+	// PAL_M is PAL color at 525 lines, used in Brazil.
+	PAL_M = VideoStandard{
+		Name: StandardPALM, Color: ColorPAL, Lines: 525, ActiveLines: 480, FieldRate: 60 / 1.001, ActiveTime: 52.66e-6,
+		Subcarrier: 3575611.49, SampleRate: 3575611.49 * 4, Setup: 7.5,
+		ChromaCut: [2]float64{1300000, 1300000}, ChromaDelay: [2]int{2, 2}, TVChromaCut: 2600000,
+		Timing: &Timing525, matrix: &yuvMatrix,
+	}
+	// PAL_N is PAL at 625 lines with a narrower channel and a subcarrier
+	// close to NTSC's, used in Argentina, Paraguay and Uruguay.
+	PAL_N = VideoStandard{
+		Name: StandardPALN, Color: ColorPAL, Lines: 625, ActiveLines: 576, FieldRate: 50, ActiveTime: 52e-6,
+		Subcarrier: 3582056.25, SampleRate: 3582056.25 * 4, Setup: 7.5,
+		ChromaCut: [2]float64{1300000, 1300000}, ChromaDelay: [2]int{2, 2}, TVChromaCut: 2600000,
+		Timing: &Timing625, matrix: &yuvMatrix,
+	}
+	PAL_BG = VideoStandard{
+		Name: StandardPALBG, Color: ColorPAL, Lines: 625, ActiveLines: 576, FieldRate: 50, ActiveTime: 52e-6,
+		Subcarrier: 4433618.75, SampleRate: PAL_RATE, Setup: 0,
+		ChromaCut: [2]float64{1300000, 1300000}, ChromaDelay: [2]int{2, 2}, TVChromaCut: 2600000,
+		Timing: &Timing625, matrix: &yuvMatrix,
+	}
+	SECAM = VideoStandard{
+		Name: StandardSECAM, Color: ColorSECAM, Lines: 625, ActiveLines: 576, FieldRate: 50, ActiveTime: 52e-6,
+		Subcarrier: 4433618.75, SampleRate: PAL_RATE, Setup: 0,
+		ChromaCut: [2]float64{1300000, 1300000}, ChromaDelay: [2]int{2, 2}, TVChromaCut: 2600000,
+		Timing: &Timing625, matrix: &yuvMatrix,
+	}
+)
+
+var videoStandards = []*VideoStandard{&NTSC_M, &NTSC_J, &NTSC_443, &PAL_M, &PAL_N, &PAL_BG, &SECAM}
+
+var standardAliases = map[string]*VideoStandard{
+	StandardNTSC: &NTSC_M,
+	StandardPAL:  &PAL_BG,
+}
+
+// VideoStandards returns the registered standards.
+func VideoStandards() []*VideoStandard {
+	return append([]*VideoStandard(nil), videoStandards...)
+}
+
+// LookupVideoStandard returns the standard with the given name or alias.
+func LookupVideoStandard(name string) (*VideoStandard, bool) {
+	if s, ok := standardAliases[name]; ok {
+		return s, true
+	}
+	for _, s := range videoStandards {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// standardNames returns the names and aliases of the standards for which
+// match returns true, or of all standards if match is nil.
+func standardNames(match func(s *VideoStandard) bool) []string {
+	var names []string
+	for _, alias := range []string{StandardNTSC, StandardPAL} {
+		if match == nil || match(standardAliases[alias]) {
+			names = append(names, alias)
+		}
+	}
+	for _, s := range videoStandards {
+		if match == nil || match(s) {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// FieldLines is the number of lines of a field, 262.5 for NTSC.
+func (s *VideoStandard) FieldLines() float64 {
+	return float64(s.Lines) / 2
+}
+
+// LineRate is the number of lines per second.
+func (s *VideoStandard) LineRate() float64 {
+	return s.FieldRate * s.FieldLines()
+}
+
+// ActiveSamples is the number of samples in the picture part of a line, 754
+// for NTSC-M.
+func (s *VideoStandard) ActiveSamples() int {
+	return int(math.Round(s.ActiveTime * s.SampleRate))
+}
+
+// LineSamples is the number of samples of a whole line, 910 for NTSC-M.
+// PAL-B/G has 1135.0064, rounded to 1135.
+func (s *VideoStandard) LineSamples() int {
+	return int(math.Round(s.SampleRate / s.LineRate()))
+}
+
+// lineAdvance is the number of quarter subcarrier cycles the phase moves
+// from one line of the frame to the next: 2 for the 227.5 cycles of NTSC,
+// 3 for the 283.75 of PAL-B/G.
+func (s *VideoStandard) lineAdvance() int {
+	return int(math.Round(4*s.Subcarrier/s.LineRate())) & 3
+}
+
+// nyquist is the highest frequency the standard can sample, half SampleRate.
+func (s *VideoStandard) nyquist() float64 {
+	return s.SampleRate / 2
+}
+
+// lowestNyquist is the highest frequency every standard can sample, that of
+// PAL-M.
+func lowestNyquist() float64 {
+	lowest := math.Inf(1)
+	for _, s := range videoStandards {
+		lowest = math.Min(lowest, s.nyquist())
+	}
+	return lowest
+}
+
+// setupLevel is Setup on the 0..255 luma scale of the stages, which runs
+// from blanking to white: 19 for the 7.5 IRE of NTSC-M.
+func (s *VideoStandard) setupLevel() int32 {
+	return int32(math.Round(s.Setup * 255 / 100))
+}
+
+// setupLevel is the setup the stages process luma with, 0 unless
+// EmulatingSetup is set.
+func (c *NtscConfig) setupLevel() int32 {
+	if !c.EmulatingSetup {
+		return 0
+	}
+	return c.Standard().setupLevel()
+}
+
+// Standard returns the standard selected by VideoStandard, or NTSC-M if the
+// name is unknown, which Validate reports.
+func (c *NtscConfig) Standard() *VideoStandard {
+	if s, ok := LookupVideoStandard(c.VideoStandard); ok {
+		return s
+	}
+	return &NTSC_M
+}
+
+func (c *NtscConfig) isPAL() bool {
+	return c.Standard().Color == ColorPAL
+}
+
+func (c *NtscConfig) isSECAM() bool {
+	return c.Standard().Color == ColorSECAM
+}
+
+// sampleRate is the rate of one pixel, in Hz, that every filter is designed
+// for.
+func (c *NtscConfig) sampleRate() float64 {
+	return c.Standard().SampleRate
+}
+
+// colorMatrix converts between RGB and the luma and two chroma planes in
+// 8.8 fixed point:
+//
+//	c1 = (toC1[0]*(R-Y) + toC1[1]*(B-Y)) >> 8, likewise c2
+//	R = Y + (toR[0]*c1 + toR[1]*c2) >> 8, likewise B, and G = Y - (...) >> 8
+//
+// Luma is always 0.30 R + 0.59 G + 0.11 B.
+type colorMatrix struct {
+	toC1, toC2    [2]int32
+	toR, toG, toB [2]int32
+}
+
+var (
+	// yiqMatrix is the NTSC I/Q matrix.
+	yiqMatrix = colorMatrix{
+		toC1: [2]int32{189, -69}, toC2: [2]int32{123, 105},
+		toR: [2]int32{245, 159}, toG: [2]int32{70, 166}, toB: [2]int32{-283, 436},
+	}
+	// yuvMatrix is the PAL U/V matrix, U = 0.492 (B-Y) and V = 0.877 (R-Y).
+	yuvMatrix = colorMatrix{
+		toC1: [2]int32{0, 126}, toC2: [2]int32{225, 0},
+		toR: [2]int32{0, 292}, toG: [2]int32{101, 149}, toB: [2]int32{520, 0},
+	}
+)
+
+// matrix returns the color matrix of the standard. In PAL and SECAM mode
+// the planes the stages call I and Q hold U and V.
+func (c *NtscConfig) matrix() *colorMatrix {
+	return c.Standard().matrix
+}
@@ -0,0 +1,135 @@
+package ntsc
+
+import (
+	"bytes"
+	"ntsc-wasm/pkg/image"
+	"testing"
+)
+
+func TestVideoStandardRegistry(t *testing.T) {
+	for alias, want := range map[string]string{StandardNTSC: StandardNTSCM, StandardPAL: StandardPALBG} {
+		if s, ok := LookupVideoStandard(alias); !ok || s.Name != want {
+			t.Errorf("%s resolves to %v, want %s", alias, s, want)
+		}
+	}
+	if _, ok := LookupVideoStandard("PAL-X"); ok {
+		t.Error("unknown standard found")
+	}
+
+	// Quarter cycles the subcarrier moves per line
+	advance := map[string]int{
+		StandardNTSCM: 2, StandardNTSCJ: 2, StandardNTSC443: 3, StandardPALBG: 3, StandardPALM: 1, StandardPALN: 1,
+	}
+	for _, s := range VideoStandards() {
+		if s.SampleRate != 4*s.Subcarrier {
+			t.Errorf("%s samples at %v, want four times the subcarrier", s.Name, s.SampleRate)
+		}
+		if s.TVChromaCut <= 0 || s.TVChromaCut >= s.SampleRate/2 {
+			t.Errorf("%s limits TV chroma to %v Hz", s.Name, s.TVChromaCut)
+		}
+		if s.Lines&1 == 0 || s.ActiveLines >= s.Lines {
+			t.Errorf("%s has %d lines, %d active", s.Name, s.Lines, s.ActiveLines)
+		}
+		if want, ok := advance[s.Name]; ok && s.lineAdvance() != want {
+			t.Errorf("%s advances %d quarter cycles per line, want %d", s.Name, s.lineAdvance(), want)
+		}
+
+		config := DefaultNtscConfig()
+		config.VideoStandard = s.Name
+		if err := config.Validate(); err != nil {
+			t.Errorf("%s: %v", s.Name, err)
+		}
+	}
+}
+
+func TestVideoStandardRoundTrip(t *testing.T) {
+	c := image.Pixel{R: 200, G: 60, B: 40}
+	for _, s := range VideoStandards() {
+		if s.Color == ColorSECAM {
+			continue
+		}
+		config := DefaultNtscConfig()
+		config.VideoStandard = s.Name
+		config.VideoNoise = 0
+		out := processImage(t, config, flatImage(64, 48, c))
+		for _, y := range []int{20, 21, 22, 23} {
+			if got := out.GetPixel(32, y); pixelDistance(got, c) > 12 {
+				t.Errorf("%s: %v came back as %v on row %d", s.Name, c, got, y)
+			}
+		}
+	}
+}
+
+func TestVideoStandardLineAdvance(t *testing.T) {
+	for _, c := range []struct {
+		standard string
+		shift    int
+		want     int
+	}{
+		{StandardNTSCM, 180, 2},
+		{StandardNTSCJ, 180, 2},
+		{StandardNTSC443, 180, 3},
+		{StandardNTSC443, 90, 1},
+		{StandardNTSC443, 270, 0},
+	} {
+		config := DefaultNtscConfig()
+		config.VideoStandard = c.standard
+		config.VideoScanlinePhaseShift = c.shift
+		p := newProcessor(t, config)
+		for field := 0; field < 2; field++ {
+			for y := field; y+2 < 48; y += 2 {
+				if got := (p.chromaLumaXi(field, y+2) - p.chromaLumaXi(field, y) + 4) & 3; got != c.want {
+					t.Fatalf("%s at %d degrees: row %d advances %d quarter cycles, want %d", c.standard, c.shift, y, got, c.want)
+				}
+			}
+		}
+	}
+}
+
+func TestVideoStandardSetup(t *testing.T) {
+	gray := image.Pixel{R: 128, G: 128, B: 128}
+	process := func(standard string, noise int, setup bool) *image.Image {
+		config := DefaultNtscConfig()
+		config.VideoStandard = standard
+		config.VideoNoise = noise
+		config.EmulatingSetup = setup
+		return processImage(t, config, flatImage(64, 48, gray))
+	}
+
+	// Setup is opt-in, so NTSC-M looks as it always has
+	if !bytes.Equal(process(StandardNTSCM, 100, false).Data, process(StandardNTSCJ, 100, false).Data) {
+		t.Error("setup applied without EmulatingSetup")
+	}
+
+	// Without noise the setup is taken back out
+	for _, standard := range []string{StandardNTSCM, StandardNTSCJ} {
+		if got := process(standard, 0, true).GetPixel(32, 24); pixelDistance(got, gray) > 3 {
+			t.Errorf("%s: %v came back as %v", standard, gray, got)
+		}
+	}
+
+	// With setup the picture spans fewer levels above blanking, so the same
+	// noise weighs more
+	withSetup, without := process(StandardNTSCM, 100, true), process(StandardNTSCJ, 100, true)
+	flat := flatImage(64, 48, gray)
+	if d, dj := meanDifference(withSetup, flat), meanDifference(without, flat); d <= dj {
+		t.Errorf("noise is %.2f with setup and %.2f without", d, dj)
+	}
+}
+
+func TestVideoStandardParams(t *testing.T) {
+	config := DefaultNtscConfig()
+	delay, _ := LookupParam("PALDelayLine")
+	timing, _ := LookupParam("OutputNTSC")
+	for name, want := range map[string][2]bool{
+		StandardNTSC:  {false, true},
+		StandardPALM:  {true, true},
+		StandardPAL:   {true, false},
+		StandardSECAM: {false, false},
+	} {
+		config.VideoStandard = name
+		if got := [2]bool{delay.Active(config), timing.Active(config)}; got != want {
+			t.Errorf("%s: PALDelayLine and OutputNTSC active %v, want %v", name, got, want)
+		}
+	}
+}
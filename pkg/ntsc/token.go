@@ -0,0 +1,252 @@
+package ntsc
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"reflect"
+)
+
+// TokenVersion is the version byte written at the start of every token.
+const TokenVersion = 1
+
+// ErrInvalidToken is returned for tokens that are malformed, corrupted or of
+// an unsupported version.
+var ErrInvalidToken = errors.New("ntsc: invalid config token")
+
+// tokenFields assigns every NtscConfig field its id in tokens. Ids are
+// positions in this list, so new fields must only be appended.
+var tokenFields = []string{
+	"CompositePreemphasis",
+	"CompositePreemphasisCut",
+	"VHSOutSharpen",
+	"VHSEdgeWave",
+	"VHSHeadSwitching",
+	"VHSHeadSwitchingPoint",
+	"VHSHeadSwitchingPhase",
+	"VHSHeadSwitchingPhaseNoise",
+	"HeadSwitchingSpeed",
+	"ColorBleedBefore",
+	"ColorBleedHoriz",
+	"ColorBleedVert",
+	"Ringing",
+	"EnableRinging2",
+	"RingingPower",
+	"RingingShift",
+	"FreqNoiseSize",
+	"FreqNoiseAmplitude",
+	"CompositeInChromaLowpass",
+	"CompositeOutChromaLowpass",
+	"CompositeOutChromaLowpassLite",
+	"VideoChromaNoise",
+	"VideoChromaPhaseNoise",
+	"VideoChromaLoss",
+	"VideoNoise",
+	"SubcarrierAmplitude",
+	"SubcarrierAmplitudeBack",
+	"EmulatingVHS",
+	"NoColorSubcarrier",
+	"VHSChromaVertBlend",
+	"VHSSVideoOut",
+	"OutputNTSC",
+	"VideoScanlinePhaseShift",
+	"VideoScanlinePhaseShiftOffset",
+	"OutputVHSTapeSpeed",
+	"BlackLineCut",
+	"Precise",
+	"RandomSeed",
+	"RandomSeed2",
+	"VideoStandard",
+	"PALPhaseError",
+	"PALDelayLine",
+	"Resample",
+	"EmulatingSetup",
+}
+
+// customTapeSpeed marks a VHSSpeed stored by value rather than by its index
+// in vhsSpeedNames.
+const customTapeSpeed = 0xff
+
+// EncodeToken packs config into a short URL-safe string. Only fields that
+// differ from DefaultNtscConfig are stored, followed by a CRC-32 of the
+// payload; DecodeToken restores the config exactly, seeds included.
+func EncodeToken(config *NtscConfig) string {
+	value := reflect.ValueOf(config).Elem()
+	defaults := reflect.ValueOf(DefaultNtscConfig()).Elem()
+
+	buf := []byte{TokenVersion}
+	for id, name := range tokenFields {
+		field := value.FieldByName(name)
+		if field.Interface() == defaults.FieldByName(name).Interface() {
+			continue
+		}
+		buf = binary.AppendUvarint(buf, uint64(id))
+		buf = appendTokenValue(buf, field)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func appendTokenValue(buf []byte, field reflect.Value) []byte {
+	switch field.Kind() {
+	case reflect.Bool:
+		if field.Bool() {
+			return append(buf, 1)
+		}
+		return append(buf, 0)
+	case reflect.Int:
+		return binary.AppendVarint(buf, field.Int())
+	case reflect.Uint32:
+		return binary.AppendUvarint(buf, field.Uint())
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(field.Float()))
+	case reflect.String:
+		buf = binary.AppendUvarint(buf, uint64(field.Len()))
+		return append(buf, field.String()...)
+	}
+
+	speed := field.Interface().(VHSSpeed)
+	for i, s := range vhsSpeedNames {
+		if speed == s.speed {
+			return append(buf, byte(i))
+		}
+	}
+	buf = append(buf, customTapeSpeed)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(speed.LumaCut))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(speed.ChromaCut))
+	return binary.AppendVarint(buf, int64(speed.ChromaDelay))
+}
+
+// DecodeToken parses a token written by EncodeToken and validates the
+// resulting config. Malformed tokens return an error wrapping
+// ErrInvalidToken.
+func DecodeToken(token string) (*NtscConfig, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if len(buf) < 5 {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidToken)
+	}
+	payload, sum := buf[:len(buf)-4], binary.LittleEndian.Uint32(buf[len(buf)-4:])
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidToken)
+	}
+	if payload[0] != TokenVersion {
+		return nil, fmt.Errorf("%w: version %d is not supported", ErrInvalidToken, payload[0])
+	}
+
+	config := DefaultNtscConfig()
+	value := reflect.ValueOf(config).Elem()
+	r := &tokenReader{buf: payload[1:]}
+	for len(r.buf) > 0 && r.err == nil {
+		id := r.uvarint()
+		if r.err != nil {
+			break
+		}
+		if id >= uint64(len(tokenFields)) {
+			return nil, fmt.Errorf("%w: unknown field %d", ErrInvalidToken, id)
+		}
+		r.readValue(value.FieldByName(tokenFields[id]))
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, r.err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+type tokenReader struct {
+	buf []byte
+	err error
+}
+
+var errTokenTruncated = errors.New("truncated")
+
+func (r *tokenReader) byte() byte {
+	if len(r.buf) < 1 {
+		r.err = errTokenTruncated
+		return 0
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *tokenReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = errTokenTruncated
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *tokenReader) varint() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = errTokenTruncated
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *tokenReader) float() float64 {
+	if len(r.buf) < 8 {
+		r.err = errTokenTruncated
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf))
+	r.buf = r.buf[8:]
+	return v
+}
+
+func (r *tokenReader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		r.err = errTokenTruncated
+		return ""
+	}
+	v := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *tokenReader) readValue(field reflect.Value) {
+	switch field.Kind() {
+	case reflect.Bool:
+		field.SetBool(r.byte() != 0)
+	case reflect.Int:
+		field.SetInt(r.varint())
+	case reflect.Uint32:
+		v := r.uvarint()
+		if v > math.MaxUint32 {
+			r.err = fmt.Errorf("seed %d out of range", v)
+		}
+		field.SetUint(v)
+	case reflect.Float64:
+		field.SetFloat(r.float())
+	case reflect.String:
+		field.SetString(r.string())
+	default:
+		var speed VHSSpeed
+		switch i := r.byte(); {
+		case i == customTapeSpeed:
+			speed.LumaCut = r.float()
+			speed.ChromaCut = r.float()
+			speed.ChromaDelay = int(r.varint())
+		case int(i) < len(vhsSpeedNames):
+			speed = vhsSpeedNames[i].speed
+		default:
+			r.err = fmt.Errorf("unknown tape speed %d", i)
+		}
+		field.Set(reflect.ValueOf(speed))
+	}
+}
@@ -0,0 +1,81 @@
+package ntsc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTokenFieldsCoverConfig(t *testing.T) {
+	ids := map[string]bool{}
+	for _, name := range tokenFields {
+		if ids[name] {
+			t.Errorf("%s listed twice", name)
+		}
+		ids[name] = true
+	}
+	typ := reflect.TypeOf(NtscConfig{})
+	for i := 0; i < typ.NumField(); i++ {
+		if !ids[typ.Field(i).Name] {
+			t.Errorf("%s has no token id", typ.Field(i).Name)
+		}
+	}
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	if token := EncodeToken(DefaultNtscConfig()); len(token) > 8 {
+		t.Errorf("default config encoded to %q", token)
+	}
+
+	vhs := DefaultNtscConfig()
+	vhs.EmulatingVHS = true
+	vhs.VHSOutSharpen = 0.4
+	vhs.VHSEdgeWave = 20
+	vhs.OutputVHSTapeSpeed = VHS_EP
+	vhs.ColorBleedBefore = false
+	vhs.RandomSeed = 0xffffffff
+	vhs.RandomSeed2 = 0
+
+	custom := DefaultNtscConfig()
+	custom.OutputVHSTapeSpeed = VHSSpeed{2000000, 290000, 11}
+	custom.RingingShift = -3
+	custom.VHSHeadSwitchingPoint = 0.9
+	custom.VideoStandard = StandardPAL
+	custom.PALDelayLine = 0.25
+
+	for name, config := range map[string]*NtscConfig{
+		"default": DefaultNtscConfig(),
+		"vhs":     vhs,
+		"custom":  custom,
+	} {
+		token := EncodeToken(config)
+		got, err := DecodeToken(token)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if *got != *config {
+			t.Errorf("%s: %q decoded to\n%+v\nwant\n%+v", name, token, *got, *config)
+		}
+	}
+}
+
+func TestTokenErrors(t *testing.T) {
+	config := DefaultNtscConfig()
+	config.VideoNoise = 40
+	config.RandomSeed = 7
+	token := EncodeToken(config)
+
+	flipped := []byte(token)
+	flipped[2] ^= 1
+	for name, token := range map[string]string{
+		"empty":      "",
+		"not base64": "!!!!",
+		"truncated":  token[:len(token)-2],
+		"corrupted":  string(flipped),
+	} {
+		if _, err := DecodeToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ntsc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// MinImageWidth and MinImageHeight are the smallest images the stages
+	// can process; chromaFromLuma needs a two-sample lookahead per row and
+	// each field needs at least one row.
+	MinImageWidth  = 4
+	MinImageHeight = 2
+)
+
+// ErrImageTooSmall is returned for images below MinImageWidth x MinImageHeight.
+var ErrImageTooSmall = errors.New("ntsc: image too small")
+
+// FieldError reports a single NtscConfig field whose value is outside of its
+// allowed range.
+type FieldError struct {
+	Field   string
+	Value   interface{}
+	Allowed string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s = %v, allowed %s", e.Field, e.Value, e.Allowed)
+}
+
+// ValidationError lists every invalid field found by NtscConfig.Validate.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "ntsc: invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Field returns the error for the named field, or nil if it is valid.
+func (e *ValidationError) Field(name string) *FieldError {
+	for _, f := range e.Fields {
+		if f.Field == name {
+			return f
+		}
+	}
+	return nil
+}
+
+type validator struct {
+	errs []*FieldError
+}
+
+func (v *validator) intRange(field string, value, min, max int) {
+	if value < min || value > max {
+		v.errs = append(v.errs, &FieldError{field, value, fmt.Sprintf("%d to %d", min, max)})
+	}
+}
+
+func (v *validator) floatRange(field string, value, min, max float64) {
+	if math.IsNaN(value) || value < min || value > max {
+		v.errs = append(v.errs, &FieldError{field, value, fmt.Sprintf("%g to %g", min, max)})
+	}
+}
+
+func (v *validator) oneOf(field string, value int, allowed ...int) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	strs := make([]string, len(allowed))
+	for i, a := range allowed {
+		strs[i] = fmt.Sprint(a)
+	}
+	v.errs = append(v.errs, &FieldError{field, value, "one of " + strings.Join(strs, ", ")})
+}
+
+func (v *validator) oneOfNames(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.errs = append(v.errs, &FieldError{field, value, "one of " + strings.Join(allowed, ", ")})
+}
+
+// Validate checks that every field is within the range the stages can
+// handle. The returned error is a *ValidationError listing all offending
+// fields, or nil.
+func (c *NtscConfig) Validate() error {
+	if c == nil {
+		return &ValidationError{Fields: []*FieldError{{"NtscConfig", nil, "non-nil config"}}}
+	}
+
+	var v validator
+	nyquist := c.Standard().nyquist()
+
+	v.floatRange("CompositePreemphasis", c.CompositePreemphasis, 0, 16)
+	v.floatRange("CompositePreemphasisCut", c.CompositePreemphasisCut, 0, nyquist)
+	v.floatRange("VHSOutSharpen", c.VHSOutSharpen, 0, 10)
+	v.intRange("VHSEdgeWave", c.VHSEdgeWave, 0, 100)
+	v.floatRange("VHSHeadSwitchingPoint", c.VHSHeadSwitchingPoint, 0, 1)
+	v.floatRange("VHSHeadSwitchingPhase", c.VHSHeadSwitchingPhase, 0, 1)
+	v.floatRange("VHSHeadSwitchingPhaseNoise", c.VHSHeadSwitchingPhaseNoise, 0, 1)
+	v.intRange("HeadSwitchingSpeed", c.HeadSwitchingSpeed, 0, 1000)
+	v.intRange("ColorBleedHoriz", c.ColorBleedHoriz, -100, 100)
+	v.intRange("ColorBleedVert", c.ColorBleedVert, -100, 100)
+	v.floatRange("Ringing", c.Ringing, 0, 10)
+	v.intRange("RingingPower", c.RingingPower, 1, 10)
+	v.intRange("RingingShift", c.RingingShift, -10, 10)
+	v.floatRange("FreqNoiseSize", c.FreqNoiseSize, 0, 10)
+	v.floatRange("FreqNoiseAmplitude", c.FreqNoiseAmplitude, 0, 10)
+	v.intRange("VideoChromaNoise", c.VideoChromaNoise, 0, 16384)
+	v.intRange("VideoChromaPhaseNoise", c.VideoChromaPhaseNoise, 0, 1000)
+	v.intRange("VideoChromaLoss", c.VideoChromaLoss, 0, 100000)
+	v.intRange("VideoNoise", c.VideoNoise, 0, 10000)
+	v.intRange("SubcarrierAmplitude", c.SubcarrierAmplitude, 0, 1000)
+	v.intRange("SubcarrierAmplitudeBack", c.SubcarrierAmplitudeBack, 0, 1000)
+	v.oneOf("VideoScanlinePhaseShift", c.VideoScanlinePhaseShift, 0, 90, 180, 270)
+	v.oneOfNames("VideoStandard", c.VideoStandard, standardNames(nil)...)
+	v.floatRange("PALPhaseError", c.PALPhaseError, -90, 90)
+	v.floatRange("PALDelayLine", c.PALDelayLine, 0, 1)
+	v.intRange("VideoScanlinePhaseShiftOffset", c.VideoScanlinePhaseShiftOffset, 0, 3)
+	v.floatRange("OutputVHSTapeSpeed.LumaCut", c.OutputVHSTapeSpeed.LumaCut, 1, nyquist)
+	v.floatRange("OutputVHSTapeSpeed.ChromaCut", c.OutputVHSTapeSpeed.ChromaCut, 1, nyquist)
+	v.intRange("OutputVHSTapeSpeed.ChromaDelay", c.OutputVHSTapeSpeed.ChromaDelay, 0, 64)
+
+	if len(v.errs) > 0 {
+		return &ValidationError{Fields: v.errs}
+	}
+	return nil
+}
+
+func validateImageSize(width, height int) error {
+	if width < MinImageWidth || height < MinImageHeight {
+		return fmt.Errorf("%w: %dx%d, need at least %dx%d", ErrImageTooSmall, width, height, MinImageWidth, MinImageHeight)
+	}
+	return nil
+}
+
+// YIQBytesPerPixel is the size of one pixel of the YIQ planes, three int32s.
+const YIQBytesPerPixel = 12
+
+// EstimateMemory returns the bytes ProcessIntoContext allocates for a
+// width x height image: the YIQ planes of both fields and, for
+// BlackLineCut, a copy of the source. Per-row scratch buffers are ignored.
+func EstimateMemory(width, height int) int64 {
+	pixels := int64(width) * int64(height)
+	return pixels * (2*YIQBytesPerPixel + 3)
+}
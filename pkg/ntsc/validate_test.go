@@ -0,0 +1,75 @@
+package ntsc
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for name, config := range stageConfigs() {
+		if err := config.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	config := DefaultNtscConfig()
+	config.VideoNoise = -1
+	config.RingingPower = 0
+	config.VideoScanlinePhaseShift = 45
+	config.Ringing = math.NaN()
+
+	err := config.Validate()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("got %v, want a *ValidationError", err)
+	}
+	for _, field := range []string{"VideoNoise", "RingingPower", "VideoScanlinePhaseShift", "Ringing"} {
+		if invalid.Field(field) == nil {
+			t.Errorf("%s was not reported", field)
+		}
+	}
+	if len(invalid.Fields) != 4 {
+		t.Errorf("got %d invalid fields, want 4: %v", len(invalid.Fields), err)
+	}
+
+	if _, err := NewNtscProcessor(config); !errors.As(err, &invalid) {
+		t.Errorf("NewNtscProcessor: got %v, want a *ValidationError", err)
+	}
+
+	// Config is exported, so it is checked again on every call
+	p := newProcessor(t, DefaultNtscConfig())
+	p.Config.VideoNoise = -1
+	if _, err := p.ProcessImage(testImage(64, 48)); !errors.As(err, &invalid) {
+		t.Errorf("ProcessImage: got %v, want a *ValidationError", err)
+	}
+}
+
+func TestValidateNyquist(t *testing.T) {
+	// A cutoff PAL-B/G samples but NTSC-M does not
+	cut := (NTSC_M.nyquist() + PAL_BG.nyquist()) / 2
+	for standard, valid := range map[string]bool{StandardNTSCM: false, StandardPALBG: true} {
+		config := DefaultNtscConfig()
+		config.VideoStandard = standard
+		config.CompositePreemphasisCut = cut
+		var invalid *ValidationError
+		err := config.Validate()
+		if rejected := errors.As(err, &invalid) && invalid.Field("CompositePreemphasisCut") != nil; rejected == valid {
+			t.Errorf("%s: cutoff of %v Hz valid is %v, Validate returned %v", standard, cut, !rejected, err)
+		}
+	}
+}
+
+func TestValidateImageSize(t *testing.T) {
+	p := newProcessor(t, DefaultNtscConfig())
+	for _, size := range [][2]int{{2, 2}, {64, 1}, {0, 0}} {
+		if _, err := p.ProcessImage(testImage(size[0], size[1])); !errors.Is(err, ErrImageTooSmall) {
+			t.Errorf("%dx%d: got %v, want ErrImageTooSmall", size[0], size[1], err)
+		}
+	}
+	out, err := p.ProcessImage(testImage(MinImageWidth, MinImageHeight))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Release(out)
+}
@@ -0,0 +1,434 @@
+package ntsc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"ntsc-wasm/pkg/image"
+)
+
+// Waveform is one frame of composite video as it would leave the encoder,
+// in IRE with blanking at 0, sampled at the SampleRate of Standard. Each of
+// the Lines lines of the standard holds LineSamples samples and starts at
+// the leading edge of its sync pulse, and line 0 starts with the first
+// equalizing pulse of field 0.
+type Waveform struct {
+	Standard *VideoStandard
+	// Frame is the index of the frame in a video, which sets the subcarrier
+	// phase sequence of PAL and the color difference of each SECAM line.
+	Frame       int
+	LineSamples int
+	Samples     []float64
+}
+
+// Line returns the samples of line l of the frame.
+func (w *Waveform) Line(l int) []float64 {
+	return w.Samples[l*w.LineSamples : (l+1)*w.LineSamples]
+}
+
+// WaveformSync is the timing DecodeWaveform recovered from a waveform.
+type WaveformSync struct {
+	// Offset is the sample where the frame starts, the first equalizing
+	// pulse of field 0. It is 0 unless the samples were shifted.
+	Offset int
+	// Sync is the sample of the leading edge of the sync pulse of each line.
+	Sync []int
+	// BurstPhase is the phase of the colorburst of each line in degrees,
+	// relative to a cosine that starts with the active picture, and
+	// BurstAmplitude its peak level in IRE, 0 on lines without burst.
+	BurstPhase     []float64
+	BurstAmplitude []float64
+}
+
+// pulse returns the width in seconds of the sync pulse that starts half-line
+// h of the frame, 0 if none does, and whether h is part of the vertical
+// sync. Field 0 starts at half-line 0 and field 1 halfway through line
+// Lines/2.
+func (s *VideoStandard) pulse(h int) (float64, bool) {
+	t := s.Timing
+	k := h
+	if h >= s.Lines {
+		k -= s.Lines
+	}
+	n := t.VSyncPulses
+	switch {
+	case k < n || k >= 2*n && k < 3*n:
+		return t.Equalizing, true
+	case k < 2*n:
+		return t.Broad, true
+	case h&1 == 0:
+		return t.Sync, false
+	}
+	return 0, false
+}
+
+// halfLine returns the sample where half-line h starts, counting from the
+// start of a line. Lines with an odd number of samples have the longer half
+// second.
+func (s *VideoStandard) halfLine(h int) int {
+	return h/2*s.LineSamples() + h%2*(s.LineSamples()/2)
+}
+
+// activeLine returns the line of the frame that carries row y of the
+// picture, centered in each field.
+func (s *VideoStandard) activeLine(y int) int {
+	line := s.Lines/2 - s.ActiveLines/2 + y>>1
+	if y&1 == 1 {
+		line += (s.Lines + 1) / 2
+	}
+	return line
+}
+
+// lineRow is the inverse of activeLine: the field of line l and its row,
+// which is outside the picture for lines of the blanking interval.
+func (s *VideoStandard) lineRow(l int) (int, int) {
+	field := 0
+	if 2*l >= s.Lines {
+		field = 1
+		l -= (s.Lines + 1) / 2
+	}
+	return field, 2*(l-(s.Lines/2-s.ActiveLines/2)) + field
+}
+
+// burstVector is the burst as a color difference of unit amplitude: -I
+// turned by 33 degrees to the -U axis for NTSC, and -U + V, swinging to
+// -U - V with the V switch, for PAL.
+func (s *VideoStandard) burstVector() (float64, float64) {
+	if s.Color == ColorPAL {
+		return -math.Sqrt2 / 2, math.Sqrt2 / 2
+	}
+	sin, cos := math.Sincos(33 * math.Pi / 180)
+	return sin, -cos
+}
+
+// activeStart is the sample of the first pixel of the picture on a line.
+func (s *VideoStandard) activeStart() int {
+	return int(math.Round((s.Timing.Sync + s.Timing.BackPorch) * s.SampleRate))
+}
+
+// EncodeWaveform renders img as one frame of composite video with the
+// blanking, sync and colorburst of the standard. The image is scaled to the
+// ActiveSamples x ActiveLines of the standard, its chroma limited to the
+// bandwidth of the standard if CompositeInChromaLowpass is set, and
+// modulated at SubcarrierAmplitude as chromaIntoLuma does, in the phase
+// sequence of p.Frame. The other stages of the pipeline do not run.
+func (p *NtscProcessor) EncodeWaveform(img *image.Image) (*Waveform, error) {
+	if img == nil {
+		return nil, fmt.Errorf("ntsc: nil image")
+	}
+	if len(img.Data) != img.Width*img.Height*3 {
+		return nil, fmt.Errorf("ntsc: image data does not match its dimensions")
+	}
+	if err := validateImageSize(img.Width, img.Height); err != nil {
+		return nil, err
+	}
+	if err := p.Config.Validate(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	std := p.Config.Standard()
+	t := std.Timing
+	rate := std.SampleRate
+	width, height := std.ActiveSamples(), std.ActiveLines
+	if img.Width != width || img.Height != height {
+		img = img.Scale(width, height)
+	}
+	yiq := &YIQImage{Data: make([]int32, width*height*3), Width: width, Height: height}
+	if err := p.bgr2yiq(context.Background(), img, yiq); err != nil {
+		return nil, err
+	}
+	samples := make([]float64, width)
+	amplitude := p.Config.SubcarrierAmplitude
+	for field := 0; field < 2; field++ {
+		if p.Config.CompositeInChromaLowpass {
+			p.compositeLowpass(yiq, samples, field, field)
+		}
+		p.chromaIntoLuma(yiq, field, field, amplitude)
+	}
+
+	ls := std.LineSamples()
+	w := &Waveform{Standard: std, Frame: p.Frame, LineSamples: ls, Samples: make([]float64, std.Lines*ls)}
+	active := std.activeStart()
+	burstStart := int(math.Round(t.BurstStart * rate))
+	c1, c2 := std.burstVector()
+	burst := t.BurstAmplitude * float64(amplitude) / 50
+	for l := 0; l < std.Lines; l++ {
+		line := w.Line(l)
+		hsync := false
+		for half := 0; half < 2; half++ {
+			pulse, vsync := std.pulse(2*l + half)
+			if half == 0 {
+				hsync = pulse != 0 && !vsync
+			}
+			start := std.halfLine(half)
+			for x := start; x < start+int(math.Round(pulse*rate)); x++ {
+				line[x] = t.SyncLevel
+			}
+		}
+
+		// Every line outside the vertical sync carries the burst, in the
+		// phase its row would have if it were part of the picture
+		if !hsync || std.Color == ColorSECAM {
+			continue
+		}
+		field, y := std.lineRow(l)
+		xi := p.chromaLumaXi(field, y)
+		vSign := float64(p.vSwitch(field, y))
+		for x := burstStart; x < burstStart+4*t.BurstCycles; x++ {
+			q := ((xi+x-active)%4 + 4) % 4
+			line[x] = burst * (c1*float64(p.Umult[q]) + c2*float64(p.Vmult[q])*vSign)
+		}
+	}
+
+	// Black goes to the setup of the standard, unless bgr2yiq has put it
+	// there already
+	setup := float64(p.Config.setupLevel())
+	scale := (100 - std.Setup) / (255 - setup)
+	for y := 0; y < height; y++ {
+		line := w.Line(std.activeLine(y))[active : active+width]
+		for x, v := range yiq.Data[y*width : (y+1)*width] {
+			line[x] = std.Setup + (float64(v)-setup)*scale
+		}
+	}
+	return w, nil
+}
+
+// DecodeWaveform recovers the picture of a frame encoded by EncodeWaveform,
+// which may have been shifted in time or picked up noise on the way. The
+// frame is located from the broad pulses of the vertical sync, and each
+// line from its sync pulse. The burst of each line gives the subcarrier
+// phase, the V switch of PAL from its swing between lines, and the chroma
+// gain, so chroma keeps its level when the signal is attenuated and is
+// dropped on lines without burst, as a color killer would. SECAM has no
+// burst, so the color difference of each line follows from the frame
+// number. The config must select the standard of the waveform.
+func (p *NtscProcessor) DecodeWaveform(w *Waveform) (*image.Image, *WaveformSync, error) {
+	if w == nil || w.Standard == nil {
+		return nil, nil, fmt.Errorf("ntsc: nil waveform")
+	}
+	if err := p.Config.Validate(); err != nil {
+		return nil, nil, err
+	}
+	std := p.Config.Standard()
+	if w.Standard.Name != std.Name {
+		return nil, nil, fmt.Errorf("ntsc: waveform is %s, the config decodes %s", w.Standard.Name, std.Name)
+	}
+	ls := std.LineSamples()
+	if w.LineSamples != ls || len(w.Samples) != std.Lines*ls {
+		return nil, nil, fmt.Errorf("ntsc: waveform has %d samples of %d per line, want %d of %d",
+			len(w.Samples), w.LineSamples, std.Lines*ls, ls)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sync, err := findSync(w)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := std.Timing
+	n := len(w.Samples)
+	at := func(i int) float64 {
+		return w.Samples[((i%n)+n)%n]
+	}
+	active := std.activeStart()
+	burstStart := int(math.Round(t.BurstStart * std.SampleRate))
+	subcarrier := []complex128{1, -1i, -1, 1i}
+
+	// Correlate the middle of the burst, a whole number of cycles, with the
+	// subcarrier
+	bursts := make([]complex128, std.Lines)
+	for l := range bursts {
+		if _, vsync := std.pulse(2 * l); vsync || std.Color == ColorSECAM {
+			continue
+		}
+		var z complex128
+		from, to := burstStart+4, burstStart+4*(t.BurstCycles-1)
+		for x := from; x < to; x++ {
+			z += complex(at(sync.Sync[l]+x), 0) * subcarrier[((x-active)%4+4)%4]
+		}
+		bursts[l] = z * complex(2/float64(to-from), 0)
+		sync.BurstAmplitude[l] = cmplx.Abs(bursts[l])
+		sync.BurstPhase[l] = cmplx.Phase(bursts[l]) * 180 / math.Pi
+	}
+
+	width, height := std.ActiveSamples(), std.ActiveLines
+	yiq := &YIQImage{Data: make([]int32, width*height*3), Width: width, Height: height}
+	setup := float64(p.Config.setupLevel())
+	scale := (100 - std.Setup) / (255 - setup)
+	for y := 0; y < height; y++ {
+		start := sync.Sync[std.activeLine(y)] + active
+		row := yiq.Data[y*width : (y+1)*width]
+		for x := range row {
+			row[x] = int32(math.Round(setup + (at(start+x)-std.Setup)/scale))
+		}
+	}
+
+	buf := newChromaBuffers(width)
+	samples := make([]float64, width)
+	c1, c2 := std.burstVector()
+	for field := 0; field < 2; field++ {
+		if std.Color == ColorSECAM {
+			frame := p.Frame
+			p.Frame = w.Frame
+			p.secamDecode(yiq, field, field, p.Config.SubcarrierAmplitude)
+			p.Frame = frame
+		} else {
+			for y := field; y < height; y += 2 {
+				l := std.activeLine(y)
+				z := bursts[l]
+				var vSign int32 = 1
+				if std.Color == ColorPAL {
+					var next complex128
+					if l+1 < std.Lines {
+						next = bursts[l+1]
+					}
+					vSign = palIdent(z, bursts[l-1], next, std.lineAdvance())
+				}
+				ref := cmplx.Phase(complex(c1, -c2*float64(vSign)))
+				xi := int(math.Round((cmplx.Phase(z)-ref)/(math.Pi/2))) & 3
+				amplitude := int(math.Round(50 * cmplx.Abs(z) / t.BurstAmplitude))
+				if amplitude < 50/4 {
+					amplitude = 0
+				}
+				p.demodulateRow(yiq, buf, y, xi, vSign, y == field, amplitude)
+			}
+		}
+		if p.Config.CompositeOutChromaLowpass {
+			if p.Config.CompositeOutChromaLowpassLite {
+				p.compositeLowpassTV(yiq, samples, field, field)
+			} else {
+				p.compositeLowpass(yiq, samples, field, field)
+			}
+		}
+	}
+
+	img := image.NewImage(width, height)
+	p.yiq2bgr(yiq, img, 0)
+	p.yiq2bgr(yiq, img, 1)
+	return img, sync, nil
+}
+
+// palIdent returns the sign of the V carrier of a line from its burst z
+// and the burst of the line after it, or else the line before it. On top of
+// the advance of the subcarrier, the burst swings by -90 degrees from a line
+// where V is not inverted to the next and by 90 degrees back.
+func palIdent(z, prev, next complex128, advance int) int32 {
+	var swing complex128
+	var sign int32 = 1
+	switch {
+	case next != 0:
+		swing = next / z
+	case prev != 0:
+		// The swing tells the sign of prev
+		swing, sign = z/prev, -1
+	default:
+		return 1
+	}
+	for i := 0; i < advance; i++ {
+		swing *= -1i
+	}
+	if imag(swing) < 0 {
+		return sign
+	}
+	return -sign
+}
+
+// findSync separates the sync pulses of w, finds the vertical sync of field
+// 0 from the broad pulses and the sync pulse of each line.
+func findSync(w *Waveform) (*WaveformSync, error) {
+	std := w.Standard
+	t := std.Timing
+	n := len(w.Samples)
+	rate := std.SampleRate
+	half := float64(w.LineSamples) / 2
+	mod := func(i int) int {
+		return ((i % n) + n) % n
+	}
+
+	// A 7 sample box filter keeps noise from splitting pulses and leaves
+	// the 50% points of clean edges where they were
+	smooth := make([]float64, n)
+	var sum float64
+	for i := -3; i <= 3; i++ {
+		sum += w.Samples[mod(i)]
+	}
+	for i := range smooth {
+		smooth[i] = sum / 7
+		sum += w.Samples[mod(i+4)] - w.Samples[mod(i-3)]
+	}
+	level := t.SyncLevel / 2
+	falling := func(i int) bool {
+		return smooth[mod(i-1)] >= level && smooth[mod(i)] < level
+	}
+
+	type pulse struct {
+		edge  int
+		width float64
+	}
+	var pulses []pulse
+	for i := 0; i < n; i++ {
+		if !falling(i) {
+			continue
+		}
+		end := i
+		for end < i+w.LineSamples && smooth[mod(end)] < level {
+			end++
+		}
+		pulses = append(pulses, pulse{i, float64(end-i) / rate})
+	}
+	isBroad := func(p pulse) bool {
+		return p.width > (t.Sync+t.Broad)/2
+	}
+	isSync := func(p pulse) bool {
+		return p.width > (t.Equalizing+t.Sync)/2 && !isBroad(p)
+	}
+
+	// Each run of broad pulses starts VSyncPulses half-lines into a field.
+	// The first line sync after it is an even number of half-lines into
+	// field 0 and an odd number into field 1.
+	sync := &WaveformSync{Offset: -1}
+	for j, p := range pulses {
+		if !isBroad(p) || isBroad(pulses[(j+len(pulses)-1)%len(pulses)]) {
+			continue
+		}
+		start := p.edge - std.halfLine(t.VSyncPulses)
+		k := j
+		for k < j+len(pulses) && !isSync(pulses[k%len(pulses)]) {
+			k++
+		}
+		distance := mod(pulses[k%len(pulses)].edge - start)
+		if int(math.Round(float64(distance)/half))&1 == 0 {
+			sync.Offset = mod(start)
+			break
+		}
+	}
+	if sync.Offset < 0 {
+		return nil, fmt.Errorf("ntsc: no vertical sync in waveform")
+	}
+
+	// Lock each line to the nearest edge
+	sync.Sync = make([]int, std.Lines)
+	sync.BurstPhase = make([]float64, std.Lines)
+	sync.BurstAmplitude = make([]float64, std.Lines)
+	for l := range sync.Sync {
+		expected := sync.Offset + l*w.LineSamples
+		sync.Sync[l] = mod(expected)
+		for d := 0; d <= 8; d++ {
+			if falling(expected - d) {
+				sync.Sync[l] = mod(expected - d)
+				break
+			}
+			if falling(expected + d) {
+				sync.Sync[l] = mod(expected + d)
+				break
+			}
+		}
+	}
+	return sync, nil
+}
@@ -0,0 +1,241 @@
+package ntsc
+
+import (
+	"math"
+	"ntsc-wasm/pkg/image"
+	"ntsc-wasm/pkg/random"
+	"testing"
+)
+
+func waveformProcessor(t *testing.T, standard string) *NtscProcessor {
+	t.Helper()
+	config := DefaultNtscConfig()
+	config.VideoStandard = standard
+	return newProcessor(t, config)
+}
+
+func encodeWaveform(t *testing.T, p *NtscProcessor, img *image.Image) *Waveform {
+	t.Helper()
+	w, err := p.EncodeWaveform(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func decodeWaveform(t *testing.T, p *NtscProcessor, w *Waveform) (*image.Image, *WaveformSync) {
+	t.Helper()
+	img, sync, err := p.DecodeWaveform(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img, sync
+}
+
+// runs returns the lengths of the runs of samples of line below level.
+func runs(line []float64, level float64) []int {
+	var result []int
+	for x := 0; x < len(line); x++ {
+		if line[x] >= level {
+			continue
+		}
+		start := x
+		for x < len(line) && line[x] < level {
+			x++
+		}
+		result = append(result, x-start)
+	}
+	return result
+}
+
+func TestWaveformStructure(t *testing.T) {
+	for _, s := range []*VideoStandard{&NTSC_M, &PAL_BG} {
+		p := waveformProcessor(t, s.Name)
+		w := encodeWaveform(t, p, flatImage(64, 48, image.Pixel{R: 128, G: 128, B: 128}))
+		if w.LineSamples != s.LineSamples() || len(w.Samples) != s.Lines*w.LineSamples {
+			t.Fatalf("%s: %d samples of %d per line", s.Name, len(w.Samples), w.LineSamples)
+		}
+
+		// Count the pulses of each kind over the frame
+		timing := s.Timing
+		equalizing := int(math.Round(timing.Equalizing * s.SampleRate))
+		sync := int(math.Round(timing.Sync * s.SampleRate))
+		broad := int(math.Round(timing.Broad * s.SampleRate))
+		counts := map[int]int{}
+		for l := 0; l < s.Lines; l++ {
+			for _, n := range runs(w.Line(l), timing.SyncLevel/2) {
+				counts[n]++
+			}
+		}
+		pulses := timing.VSyncPulses
+		want := map[int]int{equalizing: 4 * pulses, broad: 2 * pulses, sync: s.Lines - 3*pulses}
+		for n, c := range counts {
+			if want[n] != c {
+				t.Errorf("%s: %d pulses of %d samples, want %d", s.Name, c, n, want[n])
+			}
+		}
+
+		// A picture line: sync, burst on the back porch, then mid gray
+		line := w.Line(s.activeLine(100))
+		if line[0] != timing.SyncLevel || line[sync] != 0 {
+			t.Errorf("%s: sync is %v, back porch %v", s.Name, line[0], line[sync])
+		}
+		start := int(math.Round(timing.BurstStart * s.SampleRate))
+		for x := start; x < start+4*timing.BurstCycles-1; x++ {
+			// Samples a quarter cycle apart are in quadrature
+			if peak := math.Hypot(line[x], line[x+1]); math.Abs(peak-timing.BurstAmplitude) > 0.01 {
+				t.Fatalf("%s: burst peaks at %.1f IRE, want %.1f", s.Name, peak, timing.BurstAmplitude)
+			}
+		}
+		if line[start-1] != 0 || line[start+4*timing.BurstCycles] != 0 {
+			t.Errorf("%s: burst longer than %d cycles", s.Name, timing.BurstCycles)
+		}
+		gray := s.Setup + 128*(100-s.Setup)/255
+		if got := line[s.activeStart()+s.ActiveSamples()/2]; math.Abs(got-gray) > 1 {
+			t.Errorf("%s: gray is %.1f IRE, want %.1f", s.Name, got, gray)
+		}
+	}
+}
+
+func TestWaveformRoundTrip(t *testing.T) {
+	src := barsImage(640, 48)
+	for _, s := range VideoStandards() {
+		p := waveformProcessor(t, s.Name)
+		w := encodeWaveform(t, p, src)
+		out, sync := decodeWaveform(t, p, w)
+		if out.Width != s.ActiveSamples() || out.Height != s.ActiveLines {
+			t.Fatalf("%s: decoded %dx%d", s.Name, out.Width, out.Height)
+		}
+		if sync.Offset != 0 {
+			t.Errorf("%s: frame found at %d", s.Name, sync.Offset)
+		}
+
+		// Compare the middle of each bar
+		tolerance := 16
+		if s.Color == ColorSECAM {
+			tolerance = 48
+		}
+		for bar := 0; bar < 8; bar++ {
+			c := src.GetPixel(bar*80+40, 24)
+			for _, y := range []int{s.ActiveLines / 2, s.ActiveLines/2 + 1} {
+				x := (bar*2 + 1) * out.Width / 16
+				if got := meanPixel(out, x-8, y); pixelDistance(got, c) > tolerance {
+					t.Errorf("%s: bar %v came back as %v on row %d", s.Name, c, got, y)
+				}
+			}
+		}
+	}
+}
+
+func TestWaveformSync(t *testing.T) {
+	for _, s := range []*VideoStandard{&NTSC_M, &PAL_BG} {
+		p := waveformProcessor(t, s.Name)
+		p.Frame = 3
+		w := encodeWaveform(t, p, barsImage(640, 48))
+		want, wantSync := decodeWaveform(t, p, w)
+
+		// Start the samples elsewhere in the frame and add noise
+		shift := 5*w.LineSamples + 123
+		rnd := random.NewXorWowRandom(1)
+		shifted := &Waveform{Standard: w.Standard, Frame: w.Frame, LineSamples: w.LineSamples, Samples: make([]float64, len(w.Samples))}
+		for i := range shifted.Samples {
+			shifted.Samples[(i+shift)%len(w.Samples)] = w.Samples[i] + rnd.Uniform(-1, 1)
+		}
+		got, sync := decodeWaveform(t, p, shifted)
+		if sync.Offset != shift {
+			t.Errorf("%s: frame found at %d, want %d", s.Name, sync.Offset, shift)
+		}
+		for l := range sync.Sync {
+			if d := sync.Sync[l] - (wantSync.Sync[l]+shift)%len(w.Samples); d != 0 {
+				t.Errorf("%s: line %d synced %d samples off", s.Name, l, d)
+			}
+			if d := math.Abs(math.Remainder(sync.BurstPhase[l]-wantSync.BurstPhase[l], 360)); d > 10 {
+				t.Errorf("%s: burst phase of line %d is %.1f, want %.1f", s.Name, l, sync.BurstPhase[l], wantSync.BurstPhase[l])
+			}
+		}
+		if d := meanDifference(got, want); d > 3 {
+			t.Errorf("%s: shifted frame decodes %.2f away", s.Name, d)
+		}
+	}
+}
+
+func TestWaveformBurstPhase(t *testing.T) {
+	for _, standard := range []string{StandardNTSCM, StandardPALBG, StandardPALM} {
+		p := waveformProcessor(t, standard)
+		w := encodeWaveform(t, p, flatImage(64, 48, image.Pixel{}))
+		_, sync := decodeWaveform(t, p, w)
+		s := w.Standard
+		c1, c2 := s.burstVector()
+		for y := 0; y < s.ActiveLines; y++ {
+			l := s.activeLine(y)
+			field, row := s.lineRow(l)
+			if field != y&1 || row != y {
+				t.Fatalf("%s: row %d is on line %d, which maps back to row %d of field %d", standard, y, l, row, field)
+			}
+			if a := sync.BurstAmplitude[l]; math.Abs(a-s.Timing.BurstAmplitude) > 0.5 {
+				t.Errorf("%s: burst of line %d is %.1f IRE", standard, l, a)
+			}
+
+			// With the subcarrier advance of the row taken out, the burst
+			// stays put in NTSC and swings by 90 degrees in PAL
+			want := math.Atan2(-c2*float64(p.vSwitch(field, row)), c1)*180/math.Pi + 90*float64(p.chromaLumaXi(field, row))
+			if d := math.Remainder(sync.BurstPhase[l]-want, 360); math.Abs(d) > 1 {
+				t.Fatalf("%s: burst of line %d at %.1f degrees, want %.1f", standard, l, sync.BurstPhase[l], want)
+			}
+			if next := l + 1; s.Color == ColorPAL && y+2 < s.ActiveLines {
+				swing := math.Remainder(sync.BurstPhase[next]-sync.BurstPhase[l]-90*float64(s.lineAdvance()), 360)
+				if math.Abs(math.Abs(swing)-90) > 1 {
+					t.Fatalf("%s: burst swings %.1f degrees from line %d", standard, swing, l)
+				}
+			}
+		}
+	}
+}
+
+func TestWaveformColorKiller(t *testing.T) {
+	src := flatImage(64, 48, image.Pixel{R: 200, G: 60, B: 40})
+	for _, s := range []*VideoStandard{&NTSC_M, &PAL_BG} {
+		p := waveformProcessor(t, s.Name)
+		w := encodeWaveform(t, p, src)
+
+		// Chroma follows the level of the burst, not SubcarrierAmplitude
+		weak := waveformProcessor(t, s.Name)
+		weak.Config.SubcarrierAmplitude = 25
+		out, _ := decodeWaveform(t, p, encodeWaveform(t, weak, src))
+		if got := out.GetPixel(out.Width/2, out.Height/2); pixelDistance(got, src.GetPixel(0, 0)) > 24 {
+			t.Errorf("%s: weak chroma came back as %v", s.Name, got)
+		}
+
+		// Without burst, the picture is gray
+		for l := 0; l < s.Lines; l++ {
+			if _, vsync := s.pulse(2 * l); vsync {
+				continue
+			}
+			line := w.Line(l)
+			for x := int(math.Round(s.Timing.BurstStart * s.SampleRate)); x < s.activeStart(); x++ {
+				line[x] = 0
+			}
+		}
+		out, _ = decodeWaveform(t, p, w)
+		got := out.GetPixel(out.Width/2, out.Height/2)
+		if got.R != got.G || got.G != got.B {
+			t.Errorf("%s: decoded %v without burst, want gray", s.Name, got)
+		}
+	}
+}
+
+func TestWaveformErrors(t *testing.T) {
+	p := waveformProcessor(t, StandardPALBG)
+	w := encodeWaveform(t, p, flatImage(64, 48, image.Pixel{}))
+	if _, _, err := waveformProcessor(t, StandardNTSCM).DecodeWaveform(w); err == nil {
+		t.Error("PAL waveform decoded as NTSC")
+	}
+	w.Samples = w.Samples[:len(w.Samples)-1]
+	if _, _, err := p.DecodeWaveform(w); err == nil {
+		t.Error("short waveform decoded")
+	}
+	blank := &Waveform{Standard: w.Standard, LineSamples: w.LineSamples, Samples: make([]float64, w.Standard.Lines*w.LineSamples)}
+	if _, _, err := p.DecodeWaveform(blank); err == nil {
+		t.Error("waveform without sync decoded")
+	}
+}
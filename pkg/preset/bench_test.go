@@ -0,0 +1,62 @@
+package preset
+
+import (
+	"ntsc-wasm/pkg/image"
+	"ntsc-wasm/pkg/ntsc"
+	"testing"
+)
+
+// BenchmarkPreset processes a whole frame with every built-in preset at SD,
+// HD and 4K, for example -bench 'Preset/vhs/HD'.
+func BenchmarkPreset(b *testing.B) {
+	sizes := []struct {
+		name          string
+		width, height int
+	}{
+		{"SD", 720, 480},
+		{"HD", 1920, 1080},
+		{"4K", 3840, 2160},
+	}
+	for _, name := range Names() {
+		for _, size := range sizes {
+			name, size := name, size
+			b.Run(name+"/"+size.name, func(b *testing.B) {
+				config, err := Get(name)
+				if err != nil {
+					b.Fatal(err)
+				}
+				p, err := ntsc.NewNtscProcessor(config)
+				if err != nil {
+					b.Fatal(err)
+				}
+				src := benchImage(size.width, size.height)
+				dst := image.NewImage(size.width, size.height)
+
+				b.ReportAllocs()
+				b.SetBytes(int64(len(src.Data)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := p.ProcessInto(dst, src); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// benchImage draws color ramps over a checkerboard, so every stage sees
+// both smooth areas and sharp edges.
+func benchImage(width, height int) *image.Image {
+	img := image.NewImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetPixel(x, y, image.Pixel{
+				R: uint8(x * 255 / width),
+				G: uint8(y * 255 / height),
+				B: uint8((x/8 + y/8) % 2 * 255),
+			})
+		}
+	}
+	return img
+}
@@ -0,0 +1,101 @@
+// Package preset provides named NtscConfig presets. The built-in presets are
+// stored as JSON files in builtin/, in the same format LoadFile reads.
+package preset
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"ntsc-wasm/pkg/ntsc"
+)
+
+//go:embed builtin/*.json
+var builtinFS embed.FS
+
+// Default is the registry shared by the command-line tool, the wasm module
+// and the artifact package. It starts out with the built-in presets.
+var Default = NewRegistry()
+
+func init() {
+	if err := Default.LoadFS(builtinFS, "builtin"); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds p to the Default registry.
+func Register(p Preset) error {
+	return Default.Register(p)
+}
+
+// LoadFile adds the preset stored in the named file to the Default registry.
+func LoadFile(name string) error {
+	return Default.LoadFile(name)
+}
+
+// LoadDir adds every *.json preset in dir to the Default registry.
+func LoadDir(dir string) error {
+	return Default.LoadDir(dir)
+}
+
+// Get returns a fresh config for the named preset of the Default registry.
+func Get(name string) (*ntsc.NtscConfig, error) {
+	return Default.Get(name)
+}
+
+// ListPresets returns the presets of the Default registry sorted by name.
+func ListPresets() []Preset {
+	return Default.List()
+}
+
+// Names returns the names of the presets of the Default registry in sorted
+// order.
+func Names() []string {
+	return Default.Names()
+}
+
+// Decode parses a partial JSON config. Fields the document omits keep the
+// values of the preset named by its "base" key, or of DefaultNtscConfig when
+// there is none.
+func Decode(data []byte) (*ntsc.NtscConfig, error) {
+	return DecodeOnto(ntsc.DefaultNtscConfig(), data)
+}
+
+// DecodeOnto is like Decode, but starts from a copy of config when the
+// document names no base preset. Empty data returns that copy unchanged.
+func DecodeOnto(config *ntsc.NtscConfig, data []byte) (*ntsc.NtscConfig, error) {
+	copied := *config
+	result := &copied
+	if len(data) == 0 {
+		return result, nil
+	}
+
+	var header struct {
+		Base string `json:"base"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("preset: invalid config: %v", err)
+	}
+	if header.Base != "" {
+		var err error
+		if result, err = Get(header.Base); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("preset: invalid config: %v", err)
+	}
+	return result, nil
+}
+
+// BaseName returns the preset named by the "base" key of a partial JSON
+// config, or "" if it names none or is not valid JSON.
+func BaseName(data []byte) string {
+	var header struct {
+		Base string `json:"base"`
+	}
+	if json.Unmarshal(data, &header) != nil {
+		return ""
+	}
+	return header.Base
+}
@@ -0,0 +1,98 @@
+package preset
+
+import (
+	"errors"
+	"ntsc-wasm/pkg/ntsc"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	for _, p := range ListPresets() {
+		if p.Description == "" || len(p.Tags) == 0 {
+			t.Errorf("%s: missing description or tags", p.Name)
+		}
+		if _, err := Get(p.Name); err != nil {
+			t.Errorf("%s: %v", p.Name, err)
+		}
+	}
+
+	vhs, err := Get("vhs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vhs.EmulatingVHS || vhs.VHSEdgeWave != 20 || vhs.SubcarrierAmplitude != 50 {
+		t.Errorf("vhs preset resolved to %+v", vhs)
+	}
+
+	if _, err := Get("nope"); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("got %v, want ErrUnknownPreset", err)
+	}
+}
+
+func TestRegistryExtends(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"tape.json":    `{"extends": "vhs", "config": {"VideoNoise": 30, "OutputVHSTapeSpeed": "EP"}}`,
+		"worn.json":    `{"name": "worn tape", "extends": "tape", "config": {"VHSEdgeWave": 40}}`,
+		"orphan.json":  `{"extends": "missing"}`,
+		"cycle-a.json": `{"extends": "cycle-b"}`,
+		"cycle-b.json": `{"extends": "cycle-a"}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry()
+	if err := r.LoadFS(builtinFS, "builtin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	worn, err := r.Get("worn tape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ntsc.DefaultNtscConfig()
+	want.EmulatingVHS = true
+	want.VHSOutSharpen = 0.4
+	want.VideoChromaLoss = 30
+	want.VideoNoise = 30
+	want.OutputVHSTapeSpeed = ntsc.VHS_EP
+	want.VHSEdgeWave = 40
+	if *worn != *want {
+		t.Errorf("worn tape resolved to\n%+v\nwant\n%+v", *worn, *want)
+	}
+
+	if _, err := r.Get("orphan"); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("orphan: got %v, want ErrUnknownPreset", err)
+	}
+	if _, err := r.Get("cycle-a"); err == nil {
+		t.Error("cycle-a: expected an error")
+	}
+	if err := r.Register(Preset{Name: "tape"}); err == nil {
+		t.Error("expected an error for a duplicate name")
+	}
+	if err := r.Register(Preset{Name: "bad", Config: []byte(`{"VideoNoise": "loud"}`)}); err == nil {
+		t.Error("expected an error for an invalid config")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	config, err := Decode([]byte(`{"base": "broadcast", "VideoNoise": 40}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.VideoNoise != 40 || config.VideoChromaNoise != 5 || !config.OutputNTSC {
+		t.Errorf("decoded %+v", config)
+	}
+
+	if _, err := Decode([]byte(`{"base": "nope"}`)); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("got %v, want ErrUnknownPreset", err)
+	}
+}
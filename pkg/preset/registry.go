@@ -0,0 +1,181 @@
+package preset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"ntsc-wasm/pkg/ntsc"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownPreset is returned for names that are not registered.
+var ErrUnknownPreset = errors.New("preset: unknown preset")
+
+// Preset is a named partial config. Fields Config omits keep the values of
+// the preset named by Extends, or of DefaultNtscConfig.
+type Preset struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	Extends     string          `json:"extends,omitempty"`
+	Config      json.RawMessage `json:"config,omitempty"`
+}
+
+// Registry holds named presets. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	presets map[string]*Preset
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{presets: map[string]*Preset{}}
+}
+
+// Register adds p. Names are unique; the preset named by Extends does not
+// have to be registered yet.
+func (r *Registry) Register(p Preset) error {
+	if p.Name == "" {
+		return fmt.Errorf("preset: missing name")
+	}
+	if p.Name == p.Extends {
+		return fmt.Errorf("preset: %s extends itself", p.Name)
+	}
+	if len(p.Config) > 0 {
+		// Catch unknown types and malformed JSON now rather than on first use
+		if err := json.Unmarshal(p.Config, ntsc.DefaultNtscConfig()); err != nil {
+			return fmt.Errorf("preset: invalid config for %s: %v", p.Name, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.presets[p.Name]; ok {
+		return fmt.Errorf("preset: %s is already registered", p.Name)
+	}
+	r.presets[p.Name] = &p
+	return nil
+}
+
+// Lookup returns the named preset as registered, without resolving Extends.
+func (r *Registry) Lookup(name string) (Preset, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.presets[name]
+	if !ok {
+		return Preset{}, false
+	}
+	return *p, true
+}
+
+// List returns all presets sorted by name.
+func (r *Registry) List() []Preset {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Preset, 0, len(r.presets))
+	for _, p := range r.presets {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Names returns the names of all presets in sorted order.
+func (r *Registry) Names() []string {
+	list := r.List()
+	names := make([]string, len(list))
+	for i, p := range list {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// Get resolves the named preset and its ancestors into a fresh config. The
+// error wraps ErrUnknownPreset if name or an ancestor is not registered.
+func (r *Registry) Get(name string) (*ntsc.NtscConfig, error) {
+	r.mu.RLock()
+	var chain []*Preset
+	seen := map[string]bool{}
+	for next := name; next != ""; {
+		if seen[next] {
+			r.mu.RUnlock()
+			return nil, fmt.Errorf("preset: %s has an extends cycle through %s", name, next)
+		}
+		seen[next] = true
+		p, ok := r.presets[next]
+		if !ok {
+			r.mu.RUnlock()
+			if next != name {
+				return nil, fmt.Errorf("%w %q, extended by %s", ErrUnknownPreset, next, chain[len(chain)-1].Name)
+			}
+			return nil, fmt.Errorf("%w %q (available: %s)", ErrUnknownPreset, name, strings.Join(r.Names(), ", "))
+		}
+		chain = append(chain, p)
+		next = p.Extends
+	}
+	r.mu.RUnlock()
+
+	config := ntsc.DefaultNtscConfig()
+	for i := len(chain) - 1; i >= 0; i-- {
+		if len(chain[i].Config) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(chain[i].Config, config); err != nil {
+			return nil, fmt.Errorf("preset: invalid config for %s: %v", chain[i].Name, err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("preset %s: %w", name, err)
+	}
+	return config, nil
+}
+
+// LoadFile registers the preset stored as JSON in the named file. If the
+// document has no name, the file name without extension is used.
+func (r *Registry) LoadFile(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("preset: %v", err)
+	}
+	return r.load(filepath.Base(name), data)
+}
+
+// LoadDir registers every *.json file in dir.
+func (r *Registry) LoadDir(dir string) error {
+	return r.LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadFS registers every *.json file in the directory dir of fsys.
+func (r *Registry) LoadFS(fsys fs.FS, dir string) error {
+	matches, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("preset: %v", err)
+	}
+	for _, match := range matches {
+		data, err := fs.ReadFile(fsys, match)
+		if err != nil {
+			return fmt.Errorf("preset: %v", err)
+		}
+		if err := r.load(path.Base(match), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) load(filename string, data []byte) error {
+	var p Preset
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("preset: invalid preset file %s: %v", filename, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filename, path.Ext(filename))
+	}
+	return r.Register(p)
+}
@@ -52,3 +52,26 @@ func (r *XorWowRandom) Uniform(min, max float64) float64 {
 func (r *XorWowRandom) NextInt() int32 {
 	return int32(r.Next())
 }
+
+// DeriveSeed mixes a base seed with a stream key using the SplitMix64
+// finalizer, so that every key gets an independent, reproducible stream.
+// The result is never zero, which NewXorWowRandom would replace with the
+// current time.
+func DeriveSeed(seed uint64, key string) uint32 {
+	h := seed ^ 0x9E3779B97F4A7C15
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 0x100000001B3
+	}
+	h ^= h >> 30
+	h *= 0xBF58476D1CE4E5B9
+	h ^= h >> 27
+	h *= 0x94D049BB133111EB
+	h ^= h >> 31
+
+	derived := uint32(h) ^ uint32(h>>32)
+	if derived == 0 {
+		derived = 1
+	}
+	return derived
+}
@@ -3,6 +3,14 @@ let wasmReady = false;
 let currentImageData = null;
 let currentRequestId = 0;
 let processingRequestId = null;
+const pendingFrameRequests = new Set();
+
+// Config schema version the controls below are written for, see
+// ntsc.ConfigVersion; older documents are migrated when loaded
+const CONFIG_VERSION = 2;
+
+// Video standard aliases, shown under their full names
+const standardAliases = { 'NTSC': 'NTSC-M', 'PAL': 'PAL-B/G' };
 
 // Initialize Web Worker
 function initWorker() {
@@ -17,24 +25,40 @@ function initWorker() {
             // Initialize debug mode based on checkbox state
             const debugEnabled = document.getElementById('enableDebugLog').checked;
             wasmWorker.postMessage({ type: 'setDebugMode', enabled: debugEnabled });
+            wasmWorker.postMessage({ type: 'describeConfig' });
 
             if (currentImageData) {
                 processImage();
             }
+        } else if (data.type === 'configDescription') {
+            applyConfigDescription(JSON.parse(data.params));
         } else if (data.type === 'result') {
             if (data.requestId && data.requestId !== processingRequestId) {
                 return;
             }
             const processedImage = document.getElementById('processedImage');
             processedImage.src = data.imageData;
+            if (data.report) {
+                console.log('Processing took ' + data.report.totalMs.toFixed(1) + ' ms');
+                console.table(data.report.stages);
+            }
             document.getElementById('processStatus').style.display = 'none';
             document.getElementById('processStatus').textContent = 'Processing time: ' + data.processTime + ' ms';
             document.getElementById('processStatus').style.display = 'block';
             processingRequestId = null;
+        } else if (data.type === 'progress') {
+            if (data.requestId !== processingRequestId) {
+                return;
+            }
+            const processStatus = document.getElementById('processStatus');
+            processStatus.textContent = 'Processing image... ' + Math.round(data.done * 100) + '% (' + data.stage + ')';
         } else if (data.type === 'error') {
             if (data.requestId && data.requestId !== processingRequestId) {
                 return;
             }
+            if (data.canceled) {
+                return;
+            }
             showError(data.message);
             document.getElementById('processStatus').style.display = 'none';
             processingRequestId = null;
@@ -53,6 +77,30 @@ function initWorker() {
 
 initWorker(); // Call to initialize the worker
 
+// Take slider ranges and tooltips from the parameter metadata published by
+// the wasm module. Control ids are the config field names in lower camel case.
+function applyConfigDescription(params) {
+    const controls = {};
+    document.querySelectorAll('input, select').forEach(element => {
+        controls[element.id.toLowerCase()] = element;
+    });
+
+    params.forEach(param => {
+        const element = controls[param.name.toLowerCase()];
+        if (!element) {
+            return;
+        }
+        element.title = param.description;
+        if (element.type === 'range') {
+            const min = param.softMin !== undefined ? param.softMin : param.min;
+            const max = param.softMax !== undefined ? param.softMax : param.max;
+            if (min !== undefined) element.min = min;
+            if (max !== undefined) element.max = max;
+            if (param.step) element.step = param.step;
+        }
+    });
+}
+
 document.getElementById('fileInput').addEventListener('change', (e) => {
     if (e.target.files.length > 0) {
         handleFile(e.target.files[0]);
@@ -172,13 +220,19 @@ function loadPreset(presetName) {
             document.getElementById('vhsHeadSwitching').checked = config.VHSHeadSwitching || false;
             document.getElementById('vhsChromaVertBlend').checked = config.VHSChromaVertBlend || false;
             document.getElementById('vhsSVideoOut').checked = config.VHSSVideoOut || false;
-            document.getElementById('outputVHSTapeSpeed').value = config.OutputVHSTapeSpeed || 0;
+            document.getElementById('outputVHSTapeSpeed').value = config.OutputVHSTapeSpeed || 'SP';
             document.getElementById('headSwitchingSpeed').value = config.HeadSwitchingSpeed || 0;
             document.getElementById('videoScanlinePhaseShift').value = config.VideoScanlinePhaseShift || 0;
             document.getElementById('videoScanlinePhaseShiftOffset').value = config.VideoScanlinePhaseShiftOffset || 0;
             document.getElementById('subcarrierAmplitude').value = config.SubcarrierAmplitude || 0;
+            document.getElementById('subcarrierAmplitudeBack').value = config.SubcarrierAmplitudeBack || 0;
             document.getElementById('outputNTSC').checked = config.OutputNTSC !== undefined ? config.OutputNTSC : true;
+            document.getElementById('videoStandard').value = standardAliases[config.VideoStandard] || config.VideoStandard || 'NTSC-M';
+            document.getElementById('palPhaseError').value = config.PALPhaseError || 0;
+            document.getElementById('palDelayLine').value = config.PALDelayLine !== undefined ? config.PALDelayLine : 1;
+            document.getElementById('emulatingSetup').checked = config.EmulatingSetup || false;
             document.getElementById('blackLineCut').checked = config.BlackLineCut || false;
+            document.getElementById('resample').checked = config.Resample || false;
             document.getElementById('precise').checked = config.Precise || false;
             document.getElementById('randomSeed').value = config.RandomSeed || 12345;
             document.getElementById('randomSeed2').value = config.RandomSeed2 || 67890;
@@ -203,6 +257,9 @@ async function processImage() {
     }
 
     // Generate new request ID and cancel any previous processing
+    if (processingRequestId !== null) {
+        wasmWorker.postMessage({ type: 'cancel', requestId: processingRequestId });
+    }
     currentRequestId++;
     const requestId = currentRequestId;
     processingRequestId = requestId;
@@ -213,45 +270,7 @@ async function processImage() {
     processStatus.textContent = 'Processing image...';
     errorDiv.style.display = 'none';
 
-    const config = {
-        CompositePreemphasis: parseFloat(document.getElementById('compositePreemphasis').value),
-        CompositePreemphasisCut: parseFloat(document.getElementById('compositePreemphasisCut').value),
-        ColorBleedBefore: document.getElementById('colorBleedBefore').checked,
-        ColorBleedHoriz: parseInt(document.getElementById('colorBleedHoriz').value),
-        ColorBleedVert: parseInt(document.getElementById('colorBleedVert').value),
-        Ringing: parseFloat(document.getElementById('ringing').value),
-        EnableRinging2: document.getElementById('enableRinging2').checked,
-        RingingPower: parseInt(document.getElementById('ringingPower').value),
-        RingingShift: parseInt(document.getElementById('ringingShift').value),
-        FreqNoiseSize: parseFloat(document.getElementById('freqNoiseSize').value),
-        FreqNoiseAmplitude: parseFloat(document.getElementById('freqNoiseAmplitude').value),
-        CompositeInChromaLowpass: document.getElementById('compositeInChromaLowpass').checked,
-        CompositeOutChromaLowpass: document.getElementById('compositeOutChromaLowpass').checked,
-        CompositeOutChromaLowpassLite: document.getElementById('compositeOutChromaLowpassLite').checked,
-        VideoNoise: parseInt(document.getElementById('videoNoise').value),
-        VideoChromaNoise: parseInt(document.getElementById('videoChromaNoise').value),
-        VideoChromaPhaseNoise: parseInt(document.getElementById('videoChromaPhaseNoise').value),
-        VideoChromaLoss: parseInt(document.getElementById('videoChromaLoss').value),
-        SubcarrierAmplitude: parseInt(document.getElementById('subcarrierAmplitude').value),
-        SubcarrierAmplitudeBack: parseInt(document.getElementById('subcarrierAmplitude').value),
-        EmulatingVHS: document.getElementById('emulatingVHS').checked,
-        NoColorSubcarrier: document.getElementById('noColorSubcarrier').checked,
-        VHSChromaVertBlend: document.getElementById('vhsChromaVertBlend').checked,
-        VHSSVideoOut: document.getElementById('vhsSVideoOut').checked,
-        VHSOutSharpen: parseFloat(document.getElementById('vhsOutSharpen').value),
-        VHSEdgeWave: parseInt(document.getElementById('vhsEdgeWave').value),
-        VHSHeadSwitching: document.getElementById('vhsHeadSwitching').checked,
-        VHSHeadSwitchingPhaseNoise: 0.05,
-        OutputNTSC: document.getElementById('outputNTSC').checked,
-        VideoScanlinePhaseShift: parseInt(document.getElementById('videoScanlinePhaseShift').value),
-        VideoScanlinePhaseShiftOffset: parseInt(document.getElementById('videoScanlinePhaseShiftOffset').value),
-        OutputVHSTapeSpeed: parseInt(document.getElementById('outputVHSTapeSpeed').value),
-        HeadSwitchingSpeed: parseInt(document.getElementById('headSwitchingSpeed').value),
-        BlackLineCut: document.getElementById('blackLineCut').checked,
-        Precise: document.getElementById('precise').checked,
-        RandomSeed: parseInt(document.getElementById('randomSeed').value),
-        RandomSeed2: parseInt(document.getElementById('randomSeed2').value)
-    };
+    const config = getCurrentConfig();
 
     const enableCompression = document.getElementById('enableCompression').checked;
     const maxWidth = enableCompression ? parseInt(document.getElementById('maxWidth').value) || 0 : 0;
@@ -281,7 +300,10 @@ async function processImage() {
         config: config,
         maxWidth: maxWidth,
         maxHeight: maxHeight,
-        requestId: requestId
+        requestId: requestId,
+        report: document.getElementById('enableDebugLog').checked,
+        // Saved results carry their config, see readRecipe
+        recipe: true
     };
 
     // Send message to worker to process image
@@ -354,11 +376,12 @@ function loadRandomPreset() {
     document.getElementById('vhsHeadSwitching').checked = Math.random() > 0.7;
     document.getElementById('vhsChromaVertBlend').checked = Math.random() > 0.3;
     document.getElementById('vhsSVideoOut').checked = Math.random() > 0.7;
-    document.getElementById('outputVHSTapeSpeed').value = Math.floor(Math.random() * 3);
+    document.getElementById('outputVHSTapeSpeed').value = ['SP', 'LP', 'EP'][Math.floor(Math.random() * 3)];
     document.getElementById('headSwitchingSpeed').value = Math.floor(Math.random() * 11);
     document.getElementById('videoScanlinePhaseShift').value = [0, 90, 180, 270][Math.floor(Math.random() * 4)];
     document.getElementById('videoScanlinePhaseShiftOffset').value = Math.floor(Math.random() * 4);
     document.getElementById('subcarrierAmplitude').value = Math.floor(Math.random() * 101);
+    document.getElementById('subcarrierAmplitudeBack').value = document.getElementById('subcarrierAmplitude').value;
     document.getElementById('outputNTSC').checked = Math.random() > 0.2;
     document.getElementById('blackLineCut').checked = Math.random() > 0.7;
     document.getElementById('precise').checked = Math.random() > 0.5;
@@ -484,7 +507,10 @@ async function processVideo() {
         }
 
     } catch (error) {
-        showError('Video processing failed: ' + error.message);
+        // Frames cancelled by the stop button reject as well
+        if (videoProcessing) {
+            showError('Video processing failed: ' + error.message);
+        }
     } finally {
         videoProcessing = false;
         processBtn.style.display = 'inline-block';
@@ -510,8 +536,9 @@ async function processVideoFrame(frameData, config, frameNumber, totalFrames, ti
 
         const tempHandler = (event) => {
             const data = event.data;
-            if (data.requestId === requestId) {
+            if (data.requestId === requestId && data.type !== 'progress') {
                 wasmWorker.removeEventListener('message', tempHandler);
+                pendingFrameRequests.delete(requestId);
                 if (data.type === 'videoFrameResult') {
                     resolve(data.imageData);
                 } else if (data.type === 'error') {
@@ -521,6 +548,7 @@ async function processVideoFrame(frameData, config, frameNumber, totalFrames, ti
         };
 
         wasmWorker.addEventListener('message', tempHandler);
+        pendingFrameRequests.add(requestId);
 
         const request = {
             imageData: frameData,
@@ -537,6 +565,7 @@ async function processVideoFrame(frameData, config, frameNumber, totalFrames, ti
 
 function getCurrentConfig() {
     return {
+        Version: CONFIG_VERSION,
         CompositePreemphasis: parseFloat(document.getElementById('compositePreemphasis').value),
         CompositePreemphasisCut: parseFloat(document.getElementById('compositePreemphasisCut').value),
         ColorBleedBefore: document.getElementById('colorBleedBefore').checked,
@@ -556,7 +585,7 @@ function getCurrentConfig() {
         VideoChromaPhaseNoise: parseInt(document.getElementById('videoChromaPhaseNoise').value),
         VideoChromaLoss: parseInt(document.getElementById('videoChromaLoss').value),
         SubcarrierAmplitude: parseInt(document.getElementById('subcarrierAmplitude').value),
-        SubcarrierAmplitudeBack: parseInt(document.getElementById('subcarrierAmplitude').value),
+        SubcarrierAmplitudeBack: parseInt(document.getElementById('subcarrierAmplitudeBack').value),
         EmulatingVHS: document.getElementById('emulatingVHS').checked,
         NoColorSubcarrier: document.getElementById('noColorSubcarrier').checked,
         VHSChromaVertBlend: document.getElementById('vhsChromaVertBlend').checked,
@@ -566,11 +595,16 @@ function getCurrentConfig() {
         VHSHeadSwitching: document.getElementById('vhsHeadSwitching').checked,
         VHSHeadSwitchingPhaseNoise: 0.05,
         OutputNTSC: document.getElementById('outputNTSC').checked,
+        VideoStandard: document.getElementById('videoStandard').value,
+        PALPhaseError: parseFloat(document.getElementById('palPhaseError').value),
+        PALDelayLine: parseFloat(document.getElementById('palDelayLine').value),
+        EmulatingSetup: document.getElementById('emulatingSetup').checked,
         VideoScanlinePhaseShift: parseInt(document.getElementById('videoScanlinePhaseShift').value),
         VideoScanlinePhaseShiftOffset: parseInt(document.getElementById('videoScanlinePhaseShiftOffset').value),
-        OutputVHSTapeSpeed: parseInt(document.getElementById('outputVHSTapeSpeed').value),
+        OutputVHSTapeSpeed: document.getElementById('outputVHSTapeSpeed').value,
         HeadSwitchingSpeed: parseInt(document.getElementById('headSwitchingSpeed').value),
         BlackLineCut: document.getElementById('blackLineCut').checked,
+        Resample: document.getElementById('resample').checked,
         Precise: document.getElementById('precise').checked,
         RandomSeed: parseInt(document.getElementById('randomSeed').value),
         RandomSeed2: parseInt(document.getElementById('randomSeed2').value)
@@ -579,6 +613,9 @@ function getCurrentConfig() {
 
 function stopVideoProcessing() {
     videoProcessing = false;
+    for (const requestId of pendingFrameRequests) {
+        wasmWorker.postMessage({ type: 'cancel', requestId: requestId });
+    }
     document.getElementById('processVideoBtn').style.display = 'inline-block';
     document.getElementById('stopVideoBtn').style.display = 'none';
     document.getElementById('videoProgress').style.display = 'none';
@@ -18,10 +18,22 @@ async function loadWasm() {
 
 loadWasm();
 
-onmessage = function(e) {
+function postProgress(requestId, frameNumber) {
+    return (stage, done) => {
+        postMessage({ type: 'progress', requestId: requestId, frameNumber: frameNumber, stage: stage, done: done });
+    };
+}
+
+onmessage = async function(e) {
     const { type, request, presetName, enabled } = e.data;
 
-    if (type === 'setDebugMode') {
+    if (type === 'cancel') {
+        try {
+            cancelRequest(e.data.requestId);
+        } catch (error) {
+            console.error('Failed to cancel request:', error);
+        }
+    } else if (type === 'setDebugMode') {
         try {
             setDebugMode(enabled);
         } catch (error) {
@@ -29,10 +41,10 @@ onmessage = function(e) {
         }
     } else if (type === 'processImage') {
         try {
-            let imageData, config, requestId;
+            let imageData, config, requestId, report, recipe;
             
             if (e.data.request) {
-                ({ imageData, config, requestId } = e.data.request);
+                ({ imageData, config, requestId, report, recipe } = e.data.request);
             } else {
                 imageData = e.data.imageData;
                 config = e.data.config || {};
@@ -40,7 +52,7 @@ onmessage = function(e) {
             }
             
             const startTime = performance.now();
-            const result = processNTSC(JSON.stringify({ imageData, config }));
+            const result = await processNTSCAsync(JSON.stringify({ imageData, config, report, recipe }), requestId, postProgress(requestId));
             const endTime = performance.now();
             const processTime = (endTime - startTime).toFixed(1);
 
@@ -48,6 +60,7 @@ onmessage = function(e) {
                 postMessage({ 
                     type: 'error', 
                     message: result.error,
+                    canceled: result.canceled || false,
                     requestId: requestId 
                 });
             } else {
@@ -55,6 +68,7 @@ onmessage = function(e) {
                     type: 'result', 
                     imageData: result.imageData, 
                     processTime: processTime,
+                    report: result.report,
                     requestId: requestId 
                 });
             }
@@ -81,13 +95,13 @@ onmessage = function(e) {
             }
             
             const startTime = performance.now();
-            const result = processVideoFrame(JSON.stringify({ 
+            const result = await processVideoFrameAsync(JSON.stringify({ 
                 imageData, 
                 config, 
                 frameNumber, 
                 totalFrames, 
                 timestamp 
-            }));
+            }), requestId, postProgress(requestId, frameNumber));
             const endTime = performance.now();
             const processTime = (endTime - startTime).toFixed(1);
 
@@ -95,6 +109,7 @@ onmessage = function(e) {
                 postMessage({ 
                     type: 'error', 
                     message: result.error,
+                    canceled: result.canceled || false,
                     requestId: requestId,
                     frameNumber: frameNumber
                 });
@@ -115,6 +130,17 @@ onmessage = function(e) {
                 frameNumber: e.data.frameNumber || (e.data.request ? e.data.request.frameNumber : null)
             });
         }
+    } else if (type === 'describeConfig') {
+        try {
+            const result = describeConfig();
+            if (result.error) {
+                postMessage({ type: 'error', message: result.error });
+            } else {
+                postMessage({ type: 'configDescription', params: result.params, schema: result.schema });
+            }
+        } catch (error) {
+            postMessage({ type: 'error', message: 'Failed to describe config in worker: ' + error.message });
+        }
     } else if (type === 'getPreset') {
         try {
             const result = getPreset(presetName);